@@ -104,7 +104,7 @@ func main() {
 		webhookConfig := make(map[string]app.WebhookConfig)
 		stop := initializeWatch(completedConfig)
 		if err != nil {
-			klog.Fatalf("fail to initialize watch on config map %s: %v\n", err)
+			klog.Fatalf("fail to initialize watch on config map: %v\n", err)
 		}
 		webhookHandlers := app.NewWebhookHandlers(webhookConfig, completedConfig, cloud)
 
@@ -0,0 +1,430 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	ionoscloud "github.com/ionos-cloud/sdk-go/v6"
+	"k8s.io/klog/v2"
+)
+
+const (
+	protocolHTTP = "HTTP"
+
+	// HTTPRuleForward forwards matching requests to a target group.
+	HTTPRuleForward = "FORWARD"
+	// HTTPRuleRedirect answers matching requests with a redirect.
+	HTTPRuleRedirect = "REDIRECT"
+)
+
+// ApplicationLoadBalancer is the desired or actual state of an IONOS
+// Application Load Balancer.
+type ApplicationLoadBalancer struct {
+	ID          string
+	Name        string
+	State       string
+	IPs         []string
+	ListenerLan int32
+	TargetLan   int32
+	Rules       []HTTPForwardingRule
+}
+
+// Ready reports whether the load balancer is provisioned and accepts changes.
+func (a *ApplicationLoadBalancer) Ready() bool {
+	return a.State == stateAvailable
+}
+
+// HTTPForwardingRule applies HTTP rules to requests on a listener port.
+type HTTPForwardingRule struct {
+	ID           string
+	Name         string
+	ListenerIP   string
+	ListenerPort int32
+	HTTPRules    []HTTPRule
+}
+
+// HTTPRule forwards or redirects requests matching Host and Path. Empty
+// conditions match every request.
+type HTTPRule struct {
+	Name string
+	// Type is HTTPRuleForward or HTTPRuleRedirect.
+	Type string
+	// TargetGroupID is the target group requests are forwarded to.
+	TargetGroupID string
+	// Location and StatusCode are the redirect sent to the client.
+	Location   string
+	StatusCode int32
+	// Host has to equal the host of the request.
+	Host string
+	// Path has to be a prefix of the request path.
+	Path string
+}
+
+// TargetGroup is the desired or actual state of an IONOS target group.
+type TargetGroup struct {
+	ID      string
+	Name    string
+	State   string
+	Targets []ForwardingTarget
+}
+
+// Ready reports whether the target group is provisioned and accepts changes.
+func (t *TargetGroup) Ready() bool {
+	return t.State == stateAvailable
+}
+
+// ListTargetGroups returns the target groups whose name starts with prefix.
+// Target groups are not bound to a datacenter.
+func (a *IONOSClient) ListTargetGroups(ctx context.Context, prefix string) ([]TargetGroup, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	groups, _, err := a.client.TargetGroupsApi.TargetgroupsGet(ctx).Depth(2).Execute()
+	if err != nil {
+		return nil, err
+	}
+	if groups.Items == nil {
+		return nil, nil
+	}
+	var result []TargetGroup
+	for _, group := range *groups.Items {
+		if group.Properties != nil && strings.HasPrefix(stringValue(group.Properties.Name), prefix) {
+			result = append(result, convertTargetGroup(group))
+		}
+	}
+	return result, nil
+}
+
+// EnsureTargetGroup creates the HTTP target group called name or replaces its
+// targets. It returns the actual state, which is not Ready while IONOS
+// provisions the target group.
+func (a *IONOSClient) EnsureTargetGroup(ctx context.Context, name string, targets []ForwardingTarget) (*TargetGroup, error) {
+	groups, err := a.ListTargetGroups(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	idx := slices.IndexFunc(groups, func(group TargetGroup) bool { return group.Name == name })
+	if idx < 0 {
+		klog.Infof("creating target group %s", name)
+		created, _, err := a.client.TargetGroupsApi.TargetgroupsPost(ctx).
+			TargetGroup(ionoscloud.TargetGroup{Properties: targetGroupProperties(name, targets)}).
+			Execute()
+		if err != nil {
+			return nil, err
+		}
+		group := convertTargetGroup(created)
+		return &group, nil
+	}
+	actual := groups[idx]
+	if !actual.Ready() || slices.Equal(sortedTargets(actual.Targets), sortedTargets(targets)) {
+		return &actual, nil
+	}
+	klog.Infof("replacing targets of target group %s", name)
+	updated, _, err := a.client.TargetGroupsApi.TargetgroupsPut(ctx, actual.ID).
+		TargetGroup(ionoscloud.TargetGroupPut{Properties: targetGroupProperties(name, targets)}).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	group := convertTargetGroup(updated)
+	return &group, nil
+}
+
+// DeleteTargetGroup deletes the target group with the given ID. Deleting a
+// missing target group succeeds.
+func (a *IONOSClient) DeleteTargetGroup(ctx context.Context, id string) error {
+	if a.client == nil {
+		return errors.New("client isn't initialized")
+	}
+	resp, err := a.client.TargetGroupsApi.TargetGroupsDelete(ctx, id).Execute()
+	if err != nil && !isNotFound(resp) {
+		return err
+	}
+	return nil
+}
+
+// GetApplicationLoadBalancer returns the Application Load Balancer called name
+// or nil if it does not exist.
+func (a *IONOSClient) GetApplicationLoadBalancer(ctx context.Context, name string) (*ApplicationLoadBalancer, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	albs, _, err := a.client.ApplicationLoadBalancersApi.DatacentersApplicationloadbalancersGet(ctx, a.DatacenterId).Depth(3).Execute()
+	if err != nil {
+		return nil, err
+	}
+	if albs.Items == nil {
+		return nil, nil
+	}
+	for _, alb := range *albs.Items {
+		if alb.Properties != nil && stringValue(alb.Properties.Name) == name {
+			return convertApplicationLoadBalancer(alb), nil
+		}
+	}
+	return nil, nil
+}
+
+// EnsureApplicationLoadBalancer creates the Application Load Balancer or
+// updates it to match desired. It returns the actual state, which is not
+// Ready while IONOS provisions the load balancer.
+func (a *IONOSClient) EnsureApplicationLoadBalancer(ctx context.Context, desired ApplicationLoadBalancer) (*ApplicationLoadBalancer, error) {
+	actual, err := a.GetApplicationLoadBalancer(ctx, desired.Name)
+	if err != nil {
+		return nil, err
+	}
+	api := a.client.ApplicationLoadBalancersApi
+	if actual == nil {
+		klog.Infof("creating application load balancer %s in datacenter %s", desired.Name, a.DatacenterId)
+		rules := make([]ionoscloud.ApplicationLoadBalancerForwardingRule, 0, len(desired.Rules))
+		for _, rule := range desired.Rules {
+			rules = append(rules, ionoscloud.ApplicationLoadBalancerForwardingRule{Properties: httpForwardingRuleProperties(rule)})
+		}
+		created, _, err := api.DatacentersApplicationloadbalancersPost(ctx, a.DatacenterId).
+			ApplicationLoadBalancer(ionoscloud.ApplicationLoadBalancer{
+				Properties: &ionoscloud.ApplicationLoadBalancerProperties{
+					Name:        ionoscloud.PtrString(desired.Name),
+					Ips:         &desired.IPs,
+					ListenerLan: ionoscloud.PtrInt32(desired.ListenerLan),
+					TargetLan:   ionoscloud.PtrInt32(desired.TargetLan),
+				},
+				Entities: &ionoscloud.ApplicationLoadBalancerEntities{
+					Forwardingrules: &ionoscloud.ApplicationLoadBalancerForwardingRules{Items: &rules},
+				},
+			}).Execute()
+		if err != nil {
+			return nil, err
+		}
+		return convertApplicationLoadBalancer(created), nil
+	}
+	if !actual.Ready() {
+		return actual, nil
+	}
+
+	if !slices.Equal(actual.IPs, desired.IPs) || actual.ListenerLan != desired.ListenerLan || actual.TargetLan != desired.TargetLan {
+		klog.Infof("updating application load balancer %s", desired.Name)
+		_, _, err := api.DatacentersApplicationloadbalancersPatch(ctx, a.DatacenterId, actual.ID).
+			ApplicationLoadBalancerProperties(ionoscloud.ApplicationLoadBalancerProperties{
+				Name:        ionoscloud.PtrString(desired.Name),
+				Ips:         &desired.IPs,
+				ListenerLan: ionoscloud.PtrInt32(desired.ListenerLan),
+				TargetLan:   ionoscloud.PtrInt32(desired.TargetLan),
+			}).Execute()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := a.syncHTTPForwardingRules(ctx, actual, desired.Rules); err != nil {
+		return nil, err
+	}
+	return a.GetApplicationLoadBalancer(ctx, desired.Name)
+}
+
+// syncHTTPForwardingRules creates, replaces and deletes the forwarding rules
+// of alb to match the desired rules by name.
+func (a *IONOSClient) syncHTTPForwardingRules(ctx context.Context, alb *ApplicationLoadBalancer, desired []HTTPForwardingRule) error {
+	api := a.client.ApplicationLoadBalancersApi
+	existing := map[string]HTTPForwardingRule{}
+	for _, rule := range alb.Rules {
+		existing[rule.Name] = rule
+	}
+	for _, rule := range desired {
+		actual, ok := existing[rule.Name]
+		delete(existing, rule.Name)
+		switch {
+		case !ok:
+			klog.Infof("creating forwarding rule %s of application load balancer %s", rule.Name, alb.Name)
+			_, _, err := api.DatacentersApplicationloadbalancersForwardingrulesPost(ctx, a.DatacenterId, alb.ID).
+				ApplicationLoadBalancerForwardingRule(ionoscloud.ApplicationLoadBalancerForwardingRule{Properties: httpForwardingRuleProperties(rule)}).
+				Execute()
+			if err != nil {
+				return fmt.Errorf("failed to create forwarding rule %s: %w", rule.Name, err)
+			}
+		case !httpForwardingRuleEqual(actual, rule):
+			klog.Infof("replacing forwarding rule %s of application load balancer %s", rule.Name, alb.Name)
+			_, _, err := api.DatacentersApplicationloadbalancersForwardingrulesPut(ctx, a.DatacenterId, alb.ID, actual.ID).
+				ApplicationLoadBalancerForwardingRule(ionoscloud.ApplicationLoadBalancerForwardingRulePut{Properties: httpForwardingRuleProperties(rule)}).
+				Execute()
+			if err != nil {
+				return fmt.Errorf("failed to replace forwarding rule %s: %w", rule.Name, err)
+			}
+		}
+	}
+	for _, rule := range existing {
+		klog.Infof("deleting forwarding rule %s of application load balancer %s", rule.Name, alb.Name)
+		if _, err := api.DatacentersApplicationloadbalancersForwardingrulesDelete(ctx, a.DatacenterId, alb.ID, rule.ID).Execute(); err != nil {
+			return fmt.Errorf("failed to delete forwarding rule %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteApplicationLoadBalancer deletes the Application Load Balancer with
+// the given ID including its forwarding rules. Deleting a missing load
+// balancer succeeds.
+func (a *IONOSClient) DeleteApplicationLoadBalancer(ctx context.Context, id string) error {
+	klog.Infof("deleting application load balancer %s in datacenter %s", id, a.DatacenterId)
+	resp, err := a.client.ApplicationLoadBalancersApi.DatacentersApplicationloadbalancersDelete(ctx, a.DatacenterId, id).Execute()
+	if err != nil && !isNotFound(resp) {
+		return err
+	}
+	return nil
+}
+
+func targetGroupProperties(name string, targets []ForwardingTarget) *ionoscloud.TargetGroupProperties {
+	groupTargets := make([]ionoscloud.TargetGroupTarget, 0, len(targets))
+	for _, target := range targets {
+		groupTargets = append(groupTargets, ionoscloud.TargetGroupTarget{
+			Ip:                 ionoscloud.PtrString(target.IP),
+			Port:               ionoscloud.PtrInt32(target.Port),
+			Weight:             ionoscloud.PtrInt32(nlbTargetWeight),
+			HealthCheckEnabled: ionoscloud.PtrBool(true),
+		})
+	}
+	return &ionoscloud.TargetGroupProperties{
+		Name:      ionoscloud.PtrString(name),
+		Algorithm: ionoscloud.PtrString(nlbAlgorithm),
+		Protocol:  ionoscloud.PtrString(protocolHTTP),
+		Targets:   &groupTargets,
+		HealthCheck: &ionoscloud.TargetGroupHealthCheck{
+			CheckInterval: ionoscloud.PtrInt32(nlbCheckInterval),
+		},
+	}
+}
+
+func httpForwardingRuleProperties(rule HTTPForwardingRule) *ionoscloud.ApplicationLoadBalancerForwardingRuleProperties {
+	httpRules := make([]ionoscloud.ApplicationLoadBalancerHttpRule, 0, len(rule.HTTPRules))
+	for _, r := range rule.HTTPRules {
+		httpRule := ionoscloud.ApplicationLoadBalancerHttpRule{
+			Name: ionoscloud.PtrString(r.Name),
+			Type: ionoscloud.PtrString(r.Type),
+		}
+		switch r.Type {
+		case HTTPRuleForward:
+			httpRule.TargetGroup = ionoscloud.PtrString(r.TargetGroupID)
+		case HTTPRuleRedirect:
+			httpRule.Location = ionoscloud.PtrString(r.Location)
+			httpRule.StatusCode = ionoscloud.PtrInt32(r.StatusCode)
+		}
+		var conditions []ionoscloud.ApplicationLoadBalancerHttpRuleCondition
+		if r.Host != "" {
+			conditions = append(conditions, ionoscloud.ApplicationLoadBalancerHttpRuleCondition{
+				Type:      ionoscloud.PtrString("HOST"),
+				Condition: ionoscloud.PtrString("EQUALS"),
+				Value:     ionoscloud.PtrString(r.Host),
+			})
+		}
+		if r.Path != "" {
+			conditions = append(conditions, ionoscloud.ApplicationLoadBalancerHttpRuleCondition{
+				Type:      ionoscloud.PtrString("PATH"),
+				Condition: ionoscloud.PtrString("STARTS_WITH"),
+				Value:     ionoscloud.PtrString(r.Path),
+			})
+		}
+		if conditions != nil {
+			httpRule.Conditions = &conditions
+		}
+		httpRules = append(httpRules, httpRule)
+	}
+	return &ionoscloud.ApplicationLoadBalancerForwardingRuleProperties{
+		Name:         ionoscloud.PtrString(rule.Name),
+		Protocol:     ionoscloud.PtrString(protocolHTTP),
+		ListenerIp:   ionoscloud.PtrString(rule.ListenerIP),
+		ListenerPort: ionoscloud.PtrInt32(rule.ListenerPort),
+		HttpRules:    &httpRules,
+	}
+}
+
+func httpForwardingRuleEqual(a, b HTTPForwardingRule) bool {
+	return a.ListenerIP == b.ListenerIP && a.ListenerPort == b.ListenerPort && slices.Equal(a.HTTPRules, b.HTTPRules)
+}
+
+func convertTargetGroup(group ionoscloud.TargetGroup) TargetGroup {
+	t := TargetGroup{ID: stringValue(group.Id)}
+	if group.Metadata != nil {
+		t.State = stringValue(group.Metadata.State)
+	}
+	if group.Properties == nil {
+		return t
+	}
+	t.Name = stringValue(group.Properties.Name)
+	if group.Properties.Targets != nil {
+		for _, target := range *group.Properties.Targets {
+			ft := ForwardingTarget{IP: stringValue(target.Ip)}
+			if target.Port != nil {
+				ft.Port = *target.Port
+			}
+			t.Targets = append(t.Targets, ft)
+		}
+	}
+	return t
+}
+
+func convertApplicationLoadBalancer(alb ionoscloud.ApplicationLoadBalancer) *ApplicationLoadBalancer {
+	a := &ApplicationLoadBalancer{ID: stringValue(alb.Id)}
+	if alb.Metadata != nil {
+		a.State = stringValue(alb.Metadata.State)
+	}
+	if p := alb.Properties; p != nil {
+		a.Name = stringValue(p.Name)
+		if p.Ips != nil {
+			a.IPs = *p.Ips
+		}
+		if p.ListenerLan != nil {
+			a.ListenerLan = *p.ListenerLan
+		}
+		if p.TargetLan != nil {
+			a.TargetLan = *p.TargetLan
+		}
+	}
+	if alb.Entities == nil || alb.Entities.Forwardingrules == nil || alb.Entities.Forwardingrules.Items == nil {
+		return a
+	}
+	for _, rule := range *alb.Entities.Forwardingrules.Items {
+		p := rule.Properties
+		if p == nil {
+			continue
+		}
+		r := HTTPForwardingRule{
+			ID:         stringValue(rule.Id),
+			Name:       stringValue(p.Name),
+			ListenerIP: stringValue(p.ListenerIp),
+		}
+		if p.ListenerPort != nil {
+			r.ListenerPort = *p.ListenerPort
+		}
+		if p.HttpRules != nil {
+			for _, httpRule := range *p.HttpRules {
+				r.HTTPRules = append(r.HTTPRules, convertHTTPRule(httpRule))
+			}
+		}
+		a.Rules = append(a.Rules, r)
+	}
+	return a
+}
+
+func convertHTTPRule(rule ionoscloud.ApplicationLoadBalancerHttpRule) HTTPRule {
+	r := HTTPRule{
+		Name:          stringValue(rule.Name),
+		Type:          stringValue(rule.Type),
+		TargetGroupID: stringValue(rule.TargetGroup),
+		Location:      stringValue(rule.Location),
+	}
+	if rule.StatusCode != nil {
+		r.StatusCode = *rule.StatusCode
+	}
+	if rule.Conditions == nil {
+		return r
+	}
+	for _, condition := range *rule.Conditions {
+		switch stringValue(condition.Type) {
+		case "HOST":
+			r.Host = stringValue(condition.Value)
+		case "PATH":
+			r.Path = stringValue(condition.Value)
+		}
+	}
+	return r
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"slices"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
@@ -20,9 +22,22 @@ import (
 type IONOSClient struct {
 	client        *ionoscloud.APIClient
 	cacheLocation string
+	lans          *lanCache
+	lanLocks      *lanLocks
+	options       Options
 	DatacenterId  string
 }
 
+// Options configures the behavior of an IONOSClient.
+type Options struct {
+	// QualifiedProviderID reports provider IDs as ionos://<datacenterID>/<serverID>.
+	QualifiedProviderID bool
+	// ClusterID identifies the resources owned by the cluster.
+	ClusterID string
+	// Scope restricts the servers considered by lookups by name or IP.
+	Scope config.ScopeConfig
+}
+
 type userpassword struct {
 	Username string   `json:"username,omitempty"`
 	Password string   `json:"password,omitempty"`
@@ -35,7 +50,65 @@ type Server struct {
 	DatacenterID string
 }
 
-func New(datacenterId string, secret []byte) (IONOSClient, error) {
+// MatchKind describes how a server was matched to a node. Lower values are
+// more confident.
+type MatchKind int
+
+const (
+	// MatchExactName matches the server name to the node name.
+	MatchExactName MatchKind = iota
+	// MatchNormalizedName matches the short, case-insensitive names, so FQDN
+	// node names match short server names and vice versa.
+	MatchNormalizedName
+	// MatchInternalIP matches the internal IPs of the node to the NIC IPs.
+	MatchInternalIP
+)
+
+func (k MatchKind) String() string {
+	switch k {
+	case MatchExactName:
+		return "exact name"
+	case MatchNormalizedName:
+		return "normalized name"
+	case MatchInternalIP:
+		return "internal IP"
+	default:
+		return fmt.Sprintf("MatchKind(%d)", int(k))
+	}
+}
+
+// ServerMatch is a server matching a node lookup.
+type ServerMatch struct {
+	Kind     MatchKind
+	Name     string
+	Instance *Instance
+}
+
+// Instance is a server together with the details the instances
+// implementation reports for its node.
+type Instance struct {
+	Metadata     *cloudprovider.InstanceMetadata
+	DatacenterID string
+	ServerID     string
+	NICs         []NIC
+	// NICsIncomplete is set if the LANs could not be listed, so Public of
+	// the NICs is unknown.
+	NICsIncomplete bool
+}
+
+// ServerState is the lifecycle state of a server.
+type ServerState struct {
+	// VMState is the state of the virtual machine, one of NOSTATE, RUNNING,
+	// BLOCKED, PAUSED, SHUTDOWN, SHUTOFF, CRASHED or SUSPENDED.
+	VMState string
+	// State is the state of the server resource, one of AVAILABLE, INACTIVE,
+	// BUSY, DEPROVISIONING or FAILED.
+	State string
+	// Type is the server type, e.g. ENTERPRISE or CUBE.
+	Type string
+}
+
+func New(datacenterId string, secret []byte, options Options) (IONOSClient, error) {
 	var cfg *ionoscloud.Configuration
 	if secret[0] == '{' {
 		var up userpassword
@@ -53,39 +126,51 @@ func New(datacenterId string, secret []byte) (IONOSClient, error) {
 	a := IONOSClient{}
 	a.client = ionoscloud.NewAPIClient(cfg)
 	a.cacheLocation = ""
+	a.lans = &lanCache{}
+	a.lanLocks = &lanLocks{}
+	a.options = options
 	a.DatacenterId = datacenterId
 	return a, nil
 }
 
-func (a *IONOSClient) GetServer(ctx context.Context, providerID string) (*cloudprovider.InstanceMetadata, error) {
+func (a *IONOSClient) GetServer(ctx context.Context, providerID string) (*Instance, error) {
 	if a.client == nil {
 		return nil, errors.New("client isn't initialized")
 	}
 	serverReq := a.client.ServersApi.DatacentersServersFindById(ctx, a.DatacenterId, providerID)
 	server, req, err := serverReq.Depth(3).Execute()
-	if err != nil || req != nil && req.StatusCode == 404 {
-		if err != nil {
+	if err != nil {
+		if isNotFound(req) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return a.convertServerToInstanceMetadata(ctx, &server)
+	return a.convertServer(ctx, &server)
 }
 
-func (a *IONOSClient) GetServerState(ctx context.Context, providerID string) (string, error) {
+// GetServerState returns the lifecycle state of a server or nil if the server
+// does not exist in this datacenter.
+func (a *IONOSClient) GetServerState(ctx context.Context, providerID string) (*ServerState, error) {
 	if a.client == nil {
-		return "", errors.New("client isn't initialized")
+		return nil, errors.New("client isn't initialized")
 	}
 	serverReq := a.client.ServersApi.DatacentersServersFindById(ctx, a.DatacenterId, providerID)
 	server, req, err := serverReq.Depth(0).Execute()
-	if err != nil || req != nil && req.StatusCode == 404 {
-		if err != nil {
-			return "", nil
+	if err != nil {
+		if isNotFound(req) {
+			return nil, nil
 		}
-		return "", err
+		return nil, err
+	}
+	state := &ServerState{}
+	if server.Properties != nil {
+		state.VMState = stringValue(server.Properties.VmState)
+		state.Type = stringValue(server.Properties.Type)
 	}
-	// Possible states: "NOSTATE" "RUNNING" "BLOCKED" "PAUSED" "SHUTDOWN" "SHUTOFF" "CRASHED" "SUSPENDED"
-	return *server.Properties.VmState, nil
+	if server.Metadata != nil {
+		state.State = stringValue(server.Metadata.State)
+	}
+	return state, nil
 }
 
 func (a *IONOSClient) RemoveIPFromNode(ctx context.Context, loadBalancerIP, providerID string) error {
@@ -106,23 +191,25 @@ func (a *IONOSClient) RemoveIPFromNode(ctx context.Context, loadBalancerIP, prov
 		return errors.New("node has no nics")
 	}
 
-	primaryNic := getPrimaryNic(*nics.Items)
-	ips := *primaryNic.Properties.Ips
+	nic := nicWithIP(*nics.Items, loadBalancerIP)
+	if nic == nil {
+		klog.Infof("IP %s is not attached to any nic of server %s", loadBalancerIP, providerID)
+		return nil
+	}
+	ips := slices.DeleteFunc(slices.Clone(*nic.Properties.Ips), func(ip string) bool { return ip == loadBalancerIP })
 
-	for idx, v := range ips {
-		if v == loadBalancerIP {
-			ips = append(ips[:idx], ips[idx+1:]...)
-		}
+	if err := a.removeFailoverIP(ctx, *nic, loadBalancerIP); err != nil {
+		return err
 	}
 
-	ready, err := a.requestReady(ctx, fmt.Sprintf("/datacenters/%s/servers/%s/nics/%s", a.DatacenterId, providerID, *primaryNic.Id))
+	ready, err := a.requestReady(ctx, fmt.Sprintf("/datacenters/%s/servers/%s/nics/%s", a.DatacenterId, providerID, *nic.Id))
 	if err != nil {
 		return err
 	}
 	if !ready {
 		return errors.New("request is not ready")
 	}
-	_, _, err = a.client.NetworkInterfacesApi.DatacentersServersNicsPatch(ctx, a.DatacenterId, providerID, *primaryNic.Id).Nic(ionoscloud.NicProperties{
+	_, _, err = a.client.NetworkInterfacesApi.DatacentersServersNicsPatch(ctx, a.DatacenterId, providerID, *nic.Id).Nic(ionoscloud.NicProperties{
 		Ips: &ips,
 	}).Execute()
 
@@ -150,16 +237,10 @@ func (a *IONOSClient) requestReady(ctx context.Context, url string) (bool, error
 	return true, nil
 }
 
-func getPrimaryNic(nics []ionoscloud.Nic) *ionoscloud.Nic {
-	for _, nic := range nics {
-		if *nic.Properties.PciSlot == 6 {
-			return &nic
-		}
-	}
-	return nil
-}
-
-func (a *IONOSClient) AttachIPToNode(ctx context.Context, loadBalancerIP, providerID string) (bool, error) {
+// AttachIPToNode adds loadBalancerIP to the NIC of the server chosen by selector
+// and points the IP failover entry of its LAN to the NIC.
+// It returns false if the server does not exist in this datacenter.
+func (a *IONOSClient) AttachIPToNode(ctx context.Context, loadBalancerIP, providerID string, selector config.NICSelector) (bool, error) {
 	if a.client == nil {
 		return false, errors.New("client isn't initialized")
 	}
@@ -177,22 +258,33 @@ func (a *IONOSClient) AttachIPToNode(ctx context.Context, loadBalancerIP, provid
 		return false, errors.New("node has no nics")
 	}
 
-	primaryNic := getPrimaryNic(*nics.Items)
-	ips := *primaryNic.Properties.Ips
-	ips = append(ips, loadBalancerIP)
-
-	ready, err := a.requestReady(ctx, fmt.Sprintf("/datacenters/%s/servers/%s/nics/%s", a.DatacenterId, providerID, *primaryNic.Id))
+	primaryNic, err := selectNIC(*nics.Items, selector)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("server %s: %w", providerID, err)
 	}
-	if !ready {
-		return false, errors.New("request is not ready")
+	var ips []string
+	if primaryNic.Properties.Ips != nil {
+		ips = slices.Clone(*primaryNic.Properties.Ips)
 	}
-	_, _, err = a.client.NetworkInterfacesApi.DatacentersServersNicsPatch(ctx, a.DatacenterId, providerID, *primaryNic.Id).Nic(ionoscloud.NicProperties{
-		Ips: &ips,
-	}).Execute()
+	if !slices.Contains(ips, loadBalancerIP) {
+		ips = append(ips, loadBalancerIP)
 
-	return true, err
+		ready, err := a.requestReady(ctx, fmt.Sprintf("/datacenters/%s/servers/%s/nics/%s", a.DatacenterId, providerID, *primaryNic.Id))
+		if err != nil {
+			return false, err
+		}
+		if !ready {
+			return false, errors.New("request is not ready")
+		}
+		_, _, err = a.client.NetworkInterfacesApi.DatacentersServersNicsPatch(ctx, a.DatacenterId, providerID, *primaryNic.Id).Nic(ionoscloud.NicProperties{
+			Ips: &ips,
+		}).Execute()
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, a.setFailoverIP(ctx, *primaryNic, loadBalancerIP)
 }
 
 func (a *IONOSClient) GetServerByIP(ctx context.Context, loadBalancerIP string) (*Server, error) {
@@ -209,8 +301,15 @@ func (a *IONOSClient) GetServerByIP(ctx context.Context, loadBalancerIP string)
 	if !servers.HasItems() {
 		return nil, nil
 	}
+	inScope, err := a.serverScope(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, server := range *servers.Items {
+		if !inScope(&server) {
+			continue
+		}
 		klog.Infof("checking server %s and looking for loadbalancer ip %s", *server.Properties.Name, loadBalancerIP)
 		if !server.Entities.HasNics() {
 			continue
@@ -235,6 +334,56 @@ func (a *IONOSClient) GetServerByIP(ctx context.Context, loadBalancerIP string)
 	return nil, nil
 }
 
+// ServersByIP returns the servers of the cluster in the datacenter by the IPs
+// of their NICs. A server having an IP on several NICs is listed once.
+func (a *IONOSClient) ServersByIP(ctx context.Context) (map[string][]Server, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	servers, _, err := a.client.ServersApi.DatacentersServersGet(ctx, a.DatacenterId).Depth(3).Execute()
+	if err != nil {
+		return nil, err
+	}
+	inScope, err := a.serverScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string][]Server{}
+	if !servers.HasItems() {
+		return result, nil
+	}
+	for _, server := range *servers.Items {
+		if !inScope(&server) || server.Entities == nil || !server.Entities.HasNics() {
+			continue
+		}
+		s := Server{ProviderID: stringValue(server.Id), DatacenterID: a.DatacenterId}
+		if server.Properties != nil {
+			s.Name = stringValue(server.Properties.Name)
+		}
+		for _, nic := range *server.Entities.Nics.Items {
+			if nic.Properties == nil || !nic.Properties.HasIps() {
+				continue
+			}
+			for _, ip := range *nic.Properties.Ips {
+				if !slices.ContainsFunc(result[ip], func(other Server) bool { return other.ProviderID == s.ProviderID }) {
+					result[ip] = append(result[ip], s)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// Ping checks that the datacenter is reachable with the configured token.
+func (a *IONOSClient) Ping(ctx context.Context) error {
+	if a.client == nil {
+		return errors.New("client isn't initialized")
+	}
+	_, _, err := a.client.DataCentersApi.DatacentersFindById(ctx, a.DatacenterId).Depth(0).Execute()
+	return err
+}
+
 func (a *IONOSClient) datacenterLocation(ctx context.Context) (string, error) {
 	if a.client == nil {
 		return "", errors.New("client isn't initialized")
@@ -250,7 +399,7 @@ func (a *IONOSClient) datacenterLocation(ctx context.Context) (string, error) {
 	return *datacenter.Properties.Location, nil
 }
 
-func (a *IONOSClient) convertServerToInstanceMetadata(ctx context.Context, server *ionoscloud.Server) (*cloudprovider.InstanceMetadata, error) {
+func (a *IONOSClient) convertServer(ctx context.Context, server *ionoscloud.Server) (*Instance, error) {
 	if a.client == nil {
 		return nil, errors.New("client isn't initialized")
 	}
@@ -290,35 +439,118 @@ func (a *IONOSClient) convertServerToInstanceMetadata(ctx context.Context, serve
 			})
 		}
 	}
+	providerID := ProviderID{ServerID: *server.Id}
+	if a.options.QualifiedProviderID {
+		providerID.DatacenterID = a.DatacenterId
+	}
 	metadata := &cloudprovider.InstanceMetadata{
-		ProviderID:    fmt.Sprintf("%s%s", config.ProviderPrefix, *server.Id),
+		ProviderID:    providerID.String(),
 		InstanceType:  fmt.Sprintf("dedicated-core-server.cpu-%s-%d.mem-%dmb", *server.Properties.CpuFamily, *server.Properties.Cores, *server.Properties.Ram),
 		NodeAddresses: addresses,
 		Zone:          *server.Properties.AvailabilityZone,
 		Region:        strings.Replace(location, "/", "-", 1),
 	}
-	return metadata, err
+	nics, err := a.convertNICs(ctx, server)
+	if err != nil {
+		klog.Warningf("failed to list lans of datacenter %s, public flags of nics are unknown: %v", a.DatacenterId, err)
+	}
+	return &Instance{
+		Metadata:       metadata,
+		DatacenterID:   a.DatacenterId,
+		ServerID:       *server.Id,
+		NICs:           nics,
+		NICsIncomplete: err != nil,
+	}, nil
 }
 
-func (a *IONOSClient) GetServerByName(ctx context.Context, name string) (*cloudprovider.InstanceMetadata, error) {
-	klog.Infof("GetServerByName %s", name)
+// FindServers returns the servers which match a node without provider ID by
+// its name or one of its internal IPs. Every server is reported with the most
+// confident kind of match only.
+func (a *IONOSClient) FindServers(ctx context.Context, name string, internalIPs []string) ([]ServerMatch, error) {
+	klog.Infof("FindServers %s %v", name, internalIPs)
 	if a.client == nil {
-		return nil, errors.New("client is initialized")
+		return nil, errors.New("client isn't initialized")
 	}
 	serverReq := a.client.ServersApi.DatacentersServersGet(ctx, a.DatacenterId)
 	servers, req, err := serverReq.Depth(3).Execute()
-	if err != nil || servers.Items == nil || req != nil && req.StatusCode == 404 {
-		if err != nil {
+	if err != nil {
+		if isNotFound(req) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if servers.Items == nil {
+		return nil, nil
+	}
+	inScope, err := a.serverScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches []ServerMatch
 	items := *servers.Items
 	for i := range items {
 		server := &items[i]
-		if server.Properties.Name != nil && *server.Properties.Name == name {
-			return a.convertServerToInstanceMetadata(ctx, server)
+		if !inScope(server) {
+			continue
+		}
+		kind, ok := matchServer(server, name, internalIPs)
+		if !ok {
+			continue
+		}
+		instance, err := a.convertServer(ctx, server)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, ServerMatch{
+			Kind:     kind,
+			Name:     stringValue(server.Properties.Name),
+			Instance: instance,
+		})
+	}
+	return matches, nil
+}
+
+func matchServer(server *ionoscloud.Server, name string, internalIPs []string) (MatchKind, bool) {
+	if server.Properties != nil && server.Properties.Name != nil {
+		serverName := *server.Properties.Name
+		if serverName == name {
+			return MatchExactName, true
+		}
+		if strings.EqualFold(shortHostname(serverName), shortHostname(name)) {
+			return MatchNormalizedName, true
 		}
 	}
-	return nil, err
+	if len(internalIPs) == 0 || server.Entities == nil || !server.Entities.HasNics() {
+		return 0, false
+	}
+	for _, nic := range *server.Entities.Nics.Items {
+		if nic.Properties == nil || !nic.Properties.HasIps() {
+			continue
+		}
+		for _, ip := range *nic.Properties.Ips {
+			if slices.Contains(internalIPs, ip) {
+				return MatchInternalIP, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// shortHostname returns the first label of a hostname, so FQDNs match their
+// short names.
+func shortHostname(name string) string {
+	short, _, _ := strings.Cut(name, ".")
+	return short
+}
+
+// isNotFound reports whether the API answered with 404 Not Found.
+func isNotFound(resp *ionoscloud.APIResponse) bool {
+	return resp != nil && resp.Response != nil && resp.StatusCode == http.StatusNotFound
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
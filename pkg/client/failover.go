@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+
+	ionoscloud "github.com/ionos-cloud/sdk-go/v6"
+	"k8s.io/klog/v2"
+)
+
+// setFailoverIP points the IP failover entry of ip in the LAN of nic to nic,
+// so IONOS routes ip to it.
+func (a *IONOSClient) setFailoverIP(ctx context.Context, nic ionoscloud.Nic, ip string) error {
+	if nic.Properties == nil || nic.Properties.Lan == nil {
+		return fmt.Errorf("nic %s is not connected to a lan", stringValue(nic.Id))
+	}
+	nicID := stringValue(nic.Id)
+	return a.updateFailoverIPs(ctx, *nic.Properties.Lan, func(entries []ionoscloud.IPFailover) []ionoscloud.IPFailover {
+		entries = slices.DeleteFunc(entries, func(entry ionoscloud.IPFailover) bool { return stringValue(entry.Ip) == ip })
+		return append(entries, ionoscloud.IPFailover{Ip: ionoscloud.PtrString(ip), NicUuid: ionoscloud.PtrString(nicID)})
+	})
+}
+
+// removeFailoverIP removes the IP failover entry of ip in the LAN of nic if it
+// points to nic. Entries pointing to other NICs belong to the new holder.
+func (a *IONOSClient) removeFailoverIP(ctx context.Context, nic ionoscloud.Nic, ip string) error {
+	if nic.Properties == nil || nic.Properties.Lan == nil {
+		return nil
+	}
+	nicID := stringValue(nic.Id)
+	return a.updateFailoverIPs(ctx, *nic.Properties.Lan, func(entries []ionoscloud.IPFailover) []ionoscloud.IPFailover {
+		return slices.DeleteFunc(entries, func(entry ionoscloud.IPFailover) bool {
+			return stringValue(entry.Ip) == ip && stringValue(entry.NicUuid) == nicID
+		})
+	})
+}
+
+// lanLocks serializes updates of the IP failover entries of a LAN, which
+// are replaced as a whole.
+type lanLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (l *lanLocks) lock(lanID string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*sync.Mutex{}
+	}
+	lock, ok := l.locks[lanID]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[lanID] = lock
+	}
+	l.mu.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// updateFailoverIPs replaces the IP failover entries of the LAN by the result
+// of update, if they changed. The entries are read again once pending
+// requests of the LAN are done, so concurrent changes are not overwritten.
+func (a *IONOSClient) updateFailoverIPs(ctx context.Context, lanID int32, update func([]ionoscloud.IPFailover) []ionoscloud.IPFailover) error {
+	if a.client == nil {
+		return errors.New("client isn't initialized")
+	}
+	id := strconv.Itoa(int(lanID))
+	defer a.lanLocks.lock(id)()
+
+	_, changed, err := a.updatedFailoverIPs(ctx, id, update)
+	if err != nil || !changed {
+		return err
+	}
+	ready, err := a.requestReady(ctx, fmt.Sprintf("/datacenters/%s/lans/%s", a.DatacenterId, id))
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return errors.New("request is not ready")
+	}
+	updated, changed, err := a.updatedFailoverIPs(ctx, id, update)
+	if err != nil || !changed {
+		return err
+	}
+	klog.Infof("updating ip failover of lan %s in datacenter %s", id, a.DatacenterId)
+	_, _, err = a.client.LANsApi.DatacentersLansPatch(ctx, a.DatacenterId, id).Lan(ionoscloud.LanProperties{
+		IpFailover: &updated,
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to update ip failover of lan %s: %w", id, err)
+	}
+	return nil
+}
+
+// updatedFailoverIPs reads the IP failover entries of the LAN and returns the
+// result of update and whether it differs from them.
+func (a *IONOSClient) updatedFailoverIPs(ctx context.Context, id string, update func([]ionoscloud.IPFailover) []ionoscloud.IPFailover) ([]ionoscloud.IPFailover, bool, error) {
+	lan, _, err := a.client.LANsApi.DatacentersLansFindById(ctx, a.DatacenterId, id).Depth(1).Execute()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get lan %s: %w", id, err)
+	}
+	var entries []ionoscloud.IPFailover
+	if lan.Properties != nil && lan.Properties.IpFailover != nil {
+		entries = *lan.Properties.IpFailover
+	}
+	updated := update(slices.Clone(entries))
+	return updated, !slices.EqualFunc(entries, updated, func(a, b ionoscloud.IPFailover) bool {
+		return stringValue(a.Ip) == stringValue(b.Ip) && stringValue(a.NicUuid) == stringValue(b.NicUuid)
+	}), nil
+}
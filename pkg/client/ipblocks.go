@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	ionoscloud "github.com/ionos-cloud/sdk-go/v6"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	labelResourceTypeIPBlock = "ipblock"
+	// ipBlockProvisionTimeout bounds the wait for a reserved IP block to
+	// become available before it is labeled.
+	ipBlockProvisionTimeout = 2 * time.Minute
+)
+
+// IPBlock is an IONOS IP block.
+type IPBlock struct {
+	ID       string
+	Name     string
+	Location string
+	State    string
+	IPs      []string
+	// Labels are only set by IPBlockOfIP.
+	Labels map[string]string
+}
+
+// Ready reports whether the IP block is provisioned and its IPs are usable.
+func (b *IPBlock) Ready() bool {
+	return b.State == stateAvailable && len(b.IPs) > 0
+}
+
+// GetIPBlock returns the IP block with the given ID or nil if it does not
+// exist. IP blocks are not bound to a datacenter.
+func (a *IONOSClient) GetIPBlock(ctx context.Context, id string) (*IPBlock, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	block, resp, err := a.client.IPBlocksApi.IpblocksFindById(ctx, id).Depth(1).Execute()
+	if isNotFound(resp) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return convertIPBlock(block), nil
+}
+
+// FindIPBlock returns the IP block labeled key=value or nil if there is none.
+// If several blocks carry the label, the one with the lowest ID is returned.
+func (a *IONOSClient) FindIPBlock(ctx context.Context, key, value string) (*IPBlock, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	ids, err := a.labeledResources(ctx, labelResourceTypeIPBlock, key, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ip blocks labeled %s=%s: %w", key, value, err)
+	}
+	for _, id := range sets.List(ids) {
+		block, err := a.GetIPBlock(ctx, id)
+		if err != nil || block != nil {
+			return block, err
+		}
+	}
+	return nil, nil
+}
+
+// ReserveIPBlock reserves an IP block with a single IP in the location of the
+// datacenter and labels it once it is available. The block is released again
+// if it cannot be labeled, as it could not be found afterwards. Busy blocks
+// cannot be released, so labeling waits for the block to become available.
+func (a *IONOSClient) ReserveIPBlock(ctx context.Context, name string, labels map[string]string) (*IPBlock, error) {
+	location, err := a.datacenterLocation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("reserving ip block %s in %s", name, location)
+	created, _, err := a.client.IPBlocksApi.IpblocksPost(ctx).Ipblock(ionoscloud.IpBlock{
+		Properties: &ionoscloud.IpBlockProperties{
+			Name:     ionoscloud.PtrString(name),
+			Location: ionoscloud.PtrString(location),
+			Size:     ionoscloud.PtrInt32(1),
+		},
+	}).Execute()
+	if err != nil {
+		return nil, err
+	}
+	block := convertIPBlock(created)
+	if err := a.waitForIPBlock(ctx, block.ID); err != nil {
+		return nil, errors.Join(err, a.ReleaseIPBlock(ctx, block.ID))
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if err := a.LabelIPBlock(ctx, block.ID, key, labels[key]); err != nil {
+			return nil, errors.Join(err, a.ReleaseIPBlock(ctx, block.ID))
+		}
+	}
+	return block, nil
+}
+
+// waitForIPBlock waits until the IP block is available.
+func (a *IONOSClient) waitForIPBlock(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, ipBlockProvisionTimeout)
+	defer cancel()
+	_, err := a.client.WaitForState(ctx, func(client *ionoscloud.APIClient, id string) (ionoscloud.ResourceHandler, error) {
+		block, _, err := client.IPBlocksApi.IpblocksFindById(ctx, id).Execute()
+		return &block, err
+	}, id)
+	if err != nil {
+		return fmt.Errorf("ip block %s did not become available: %w", id, err)
+	}
+	return nil
+}
+
+// ReleaseIPBlock deletes the IP block with the given ID. Releasing a missing
+// block succeeds.
+func (a *IONOSClient) ReleaseIPBlock(ctx context.Context, id string) error {
+	if a.client == nil {
+		return errors.New("client isn't initialized")
+	}
+	klog.Infof("releasing ip block %s", id)
+	resp, err := a.client.IPBlocksApi.IpblocksDelete(ctx, id).Execute()
+	if err != nil && !isNotFound(resp) {
+		return err
+	}
+	return nil
+}
+
+func convertIPBlock(block ionoscloud.IpBlock) *IPBlock {
+	b := &IPBlock{ID: stringValue(block.Id)}
+	if block.Metadata != nil {
+		b.State = stringValue(block.Metadata.State)
+	}
+	if p := block.Properties; p != nil {
+		b.Name = stringValue(p.Name)
+		b.Location = stringValue(p.Location)
+		if p.Ips != nil {
+			b.IPs = *p.Ips
+		}
+	}
+	return b
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	ionoscloud "github.com/ionos-cloud/sdk-go/v6"
+)
+
+// IPBlockOfIP returns the IP block containing ip together with its labels or
+// nil if no IP block of the contract contains it.
+func (a *IONOSClient) IPBlockOfIP(ctx context.Context, ip string) (*IPBlock, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	blocks, _, err := a.client.IPBlocksApi.IpblocksGet(ctx).Depth(1).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ip blocks: %w", err)
+	}
+	if blocks.Items == nil {
+		return nil, nil
+	}
+	for _, b := range *blocks.Items {
+		block := convertIPBlock(b)
+		if !slices.Contains(block.IPs, ip) {
+			continue
+		}
+		labels, _, err := a.client.LabelsApi.IpblocksLabelsGet(ctx, block.ID).Depth(1).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get labels of ip block %s: %w", block.ID, err)
+		}
+		block.Labels = convertLabels(labels)
+		return block, nil
+	}
+	return nil, nil
+}
+
+// LabelIPBlock adds the label key=value to the IP block.
+func (a *IONOSClient) LabelIPBlock(ctx context.Context, id, key, value string) error {
+	if a.client == nil {
+		return errors.New("client isn't initialized")
+	}
+	_, _, err := a.client.LabelsApi.IpblocksLabelsPost(ctx, id).Label(ionoscloud.LabelResource{
+		Properties: &ionoscloud.LabelResourceProperties{
+			Key:   ionoscloud.PtrString(key),
+			Value: ionoscloud.PtrString(value),
+		},
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to label ip block %s with %s: %w", id, key, err)
+	}
+	return nil
+}
+
+// ServerLabels returns the labels of the server.
+func (a *IONOSClient) ServerLabels(ctx context.Context, serverID string) (map[string]string, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	labels, _, err := a.client.LabelsApi.DatacentersServersLabelsGet(ctx, a.DatacenterId, serverID).Depth(1).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get labels of server %s: %w", serverID, err)
+	}
+	return convertLabels(labels), nil
+}
+
+// LabelServer adds the label key=value to the server.
+func (a *IONOSClient) LabelServer(ctx context.Context, serverID, key, value string) error {
+	if a.client == nil {
+		return errors.New("client isn't initialized")
+	}
+	_, _, err := a.client.LabelsApi.DatacentersServersLabelsPost(ctx, a.DatacenterId, serverID).Label(ionoscloud.LabelResource{
+		Properties: &ionoscloud.LabelResourceProperties{
+			Key:   ionoscloud.PtrString(key),
+			Value: ionoscloud.PtrString(value),
+		},
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to label server %s with %s: %w", serverID, key, err)
+	}
+	return nil
+}
+
+func convertLabels(labels ionoscloud.LabelResources) map[string]string {
+	result := map[string]string{}
+	if labels.Items == nil {
+		return result
+	}
+	for _, label := range *labels.Items {
+		if label.Properties != nil {
+			result[stringValue(label.Properties.Key)] = stringValue(label.Properties.Value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ionoscloud "github.com/ionos-cloud/sdk-go/v6"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// lanCacheTTL is how long the public flags of the LANs of a datacenter are
+// cached. LANs rarely change, but every node reports its NICs periodically.
+const lanCacheTTL = 5 * time.Minute
+
+// NIC describes a network interface of a server.
+type NIC struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name,omitempty"`
+	LanID   int32    `json:"lanId"`
+	MAC     string   `json:"mac"`
+	PCISlot int32    `json:"pciSlot"`
+	Public  bool     `json:"public"`
+	IPs     []string `json:"ips,omitempty"`
+}
+
+type lanCache struct {
+	mu      sync.Mutex
+	public  map[int32]bool
+	fetched time.Time
+}
+
+// convertNICs converts the NICs of a server fetched with depth 3. If the LANs
+// cannot be listed, the NICs are still converted, but Public is not set and
+// the error is returned along with them.
+func (a *IONOSClient) convertNICs(ctx context.Context, server *ionoscloud.Server) ([]NIC, error) {
+	if server.Entities == nil || !server.Entities.HasNics() {
+		return nil, nil
+	}
+	public, lanErr := a.publicLANs(ctx)
+	var nics []NIC
+	for _, nic := range *server.Entities.Nics.Items {
+		if nic.Properties == nil {
+			continue
+		}
+		n := NIC{
+			ID:   stringValue(nic.Id),
+			Name: stringValue(nic.Properties.Name),
+			MAC:  stringValue(nic.Properties.Mac),
+		}
+		if nic.Properties.Lan != nil {
+			n.LanID = *nic.Properties.Lan
+			n.Public = public[n.LanID]
+		}
+		if nic.Properties.PciSlot != nil {
+			n.PCISlot = *nic.Properties.PciSlot
+		}
+		if nic.Properties.Ips != nil {
+			n.IPs = *nic.Properties.Ips
+		}
+		nics = append(nics, n)
+	}
+	return nics, lanErr
+}
+
+// publicLANs returns whether the LANs of the datacenter are public by LAN ID.
+func (a *IONOSClient) publicLANs(ctx context.Context) (map[int32]bool, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	a.lans.mu.Lock()
+	defer a.lans.mu.Unlock()
+	if a.lans.public != nil && time.Since(a.lans.fetched) < lanCacheTTL {
+		return a.lans.public, nil
+	}
+	lans, _, err := a.client.LANsApi.DatacentersLansGet(ctx, a.DatacenterId).Depth(1).Execute()
+	if err != nil {
+		return nil, err
+	}
+	public := map[int32]bool{}
+	if lans.Items != nil {
+		for _, lan := range *lans.Items {
+			id, err := parseLanID(lan.Id)
+			if err != nil || lan.Properties == nil {
+				continue
+			}
+			public[id] = lan.Properties.Public != nil && *lan.Properties.Public
+		}
+	}
+	a.lans.public = public
+	a.lans.fetched = time.Now()
+	return public, nil
+}
+
+func parseLanID(id *string) (int32, error) {
+	if id == nil {
+		return 0, errors.New("lan has no id")
+	}
+	lanID, err := strconv.ParseInt(*id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lan id %q: %w", *id, err)
+	}
+	return int32(lanID), nil
+}
+
+// ErrNoMatchingNIC is returned if no NIC of a server matches a NIC selector.
+var ErrNoMatchingNIC = errors.New("no nic matches the selector")
+
+// defaultPrimaryPCISlot is the PCI slot of the first NIC of a server, which
+// is used if the selector is empty.
+const defaultPrimaryPCISlot = 6
+
+// selectNIC returns the NIC matching all criteria of selector. If several
+// NICs match, the one with the lowest PCI slot wins.
+func selectNIC(nics []ionoscloud.Nic, selector config.NICSelector) (*ionoscloud.Nic, error) {
+	if selector.IsEmpty() {
+		slot := int32(defaultPrimaryPCISlot)
+		selector.PCISlot = &slot
+	}
+	var namePattern *regexp.Regexp
+	if selector.NamePattern != "" {
+		var err error
+		if namePattern, err = regexp.Compile(selector.NamePattern); err != nil {
+			return nil, fmt.Errorf("invalid nic name pattern %q: %w", selector.NamePattern, err)
+		}
+	}
+	var selected *ionoscloud.Nic
+	for i := range nics {
+		nic := &nics[i]
+		if nic.Properties == nil {
+			continue
+		}
+		if selector.ID != "" && !strings.EqualFold(stringValue(nic.Id), selector.ID) {
+			continue
+		}
+		if selector.LanID != nil && (nic.Properties.Lan == nil || *nic.Properties.Lan != *selector.LanID) {
+			continue
+		}
+		if selector.PCISlot != nil && (nic.Properties.PciSlot == nil || *nic.Properties.PciSlot != *selector.PCISlot) {
+			continue
+		}
+		if namePattern != nil && !namePattern.MatchString(stringValue(nic.Properties.Name)) {
+			continue
+		}
+		if selected == nil || pciSlot(nic) < pciSlot(selected) {
+			selected = nic
+		}
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("%w %s", ErrNoMatchingNIC, selector)
+	}
+	return selected, nil
+}
+
+// nicWithIP returns the NIC which has ip attached.
+func nicWithIP(nics []ionoscloud.Nic, ip string) *ionoscloud.Nic {
+	for i := range nics {
+		nic := &nics[i]
+		if nic.Properties != nil && nic.Properties.Ips != nil && slices.Contains(*nic.Properties.Ips, ip) {
+			return nic
+		}
+	}
+	return nil
+}
+
+func pciSlot(nic *ionoscloud.Nic) int32 {
+	if nic.Properties.PciSlot == nil {
+		return math.MaxInt32
+	}
+	return *nic.Properties.PciSlot
+}
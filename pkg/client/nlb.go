@@ -0,0 +1,265 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	ionoscloud "github.com/ionos-cloud/sdk-go/v6"
+	"k8s.io/klog/v2"
+)
+
+const (
+	stateAvailable = "AVAILABLE"
+
+	nlbAlgorithm     = "ROUND_ROBIN"
+	nlbTargetWeight  = 1
+	nlbCheckInterval = 2000
+)
+
+// NetworkLoadBalancer is the desired or actual state of an IONOS Network Load
+// Balancer.
+type NetworkLoadBalancer struct {
+	ID          string
+	Name        string
+	State       string
+	IPs         []string
+	ListenerLan int32
+	TargetLan   int32
+	Rules       []ForwardingRule
+}
+
+// Ready reports whether the load balancer is provisioned and accepts changes.
+func (n *NetworkLoadBalancer) Ready() bool {
+	return n.State == stateAvailable
+}
+
+// ForwardingRule forwards a listener port to the targets.
+type ForwardingRule struct {
+	ID           string
+	Name         string
+	Protocol     string
+	ListenerIP   string
+	ListenerPort int32
+	Targets      []ForwardingTarget
+}
+
+// ForwardingTarget is a target of a forwarding rule.
+type ForwardingTarget struct {
+	IP   string
+	Port int32
+}
+
+// GetNetworkLoadBalancer returns the Network Load Balancer called name or nil
+// if it does not exist.
+func (a *IONOSClient) GetNetworkLoadBalancer(ctx context.Context, name string) (*NetworkLoadBalancer, error) {
+	if a.client == nil {
+		return nil, errors.New("client isn't initialized")
+	}
+	nlbs, _, err := a.client.NetworkLoadBalancersApi.DatacentersNetworkloadbalancersGet(ctx, a.DatacenterId).Depth(3).Execute()
+	if err != nil {
+		return nil, err
+	}
+	if nlbs.Items == nil {
+		return nil, nil
+	}
+	for _, nlb := range *nlbs.Items {
+		if nlb.Properties != nil && stringValue(nlb.Properties.Name) == name {
+			return convertNetworkLoadBalancer(nlb), nil
+		}
+	}
+	return nil, nil
+}
+
+// EnsureNetworkLoadBalancer creates the Network Load Balancer or updates it
+// to match desired. It returns the actual state, which is not Ready while
+// IONOS provisions the load balancer.
+func (a *IONOSClient) EnsureNetworkLoadBalancer(ctx context.Context, desired NetworkLoadBalancer) (*NetworkLoadBalancer, error) {
+	actual, err := a.GetNetworkLoadBalancer(ctx, desired.Name)
+	if err != nil {
+		return nil, err
+	}
+	if actual == nil {
+		klog.Infof("creating network load balancer %s in datacenter %s", desired.Name, a.DatacenterId)
+		rules := make([]ionoscloud.NetworkLoadBalancerForwardingRule, 0, len(desired.Rules))
+		for _, rule := range desired.Rules {
+			rules = append(rules, ionoscloud.NetworkLoadBalancerForwardingRule{Properties: forwardingRuleProperties(rule)})
+		}
+		created, _, err := a.client.NetworkLoadBalancersApi.DatacentersNetworkloadbalancersPost(ctx, a.DatacenterId).
+			NetworkLoadBalancer(ionoscloud.NetworkLoadBalancer{
+				Properties: &ionoscloud.NetworkLoadBalancerProperties{
+					Name:        ionoscloud.PtrString(desired.Name),
+					Ips:         &desired.IPs,
+					ListenerLan: ionoscloud.PtrInt32(desired.ListenerLan),
+					TargetLan:   ionoscloud.PtrInt32(desired.TargetLan),
+				},
+				Entities: &ionoscloud.NetworkLoadBalancerEntities{
+					Forwardingrules: &ionoscloud.NetworkLoadBalancerForwardingRules{Items: &rules},
+				},
+			}).Execute()
+		if err != nil {
+			return nil, err
+		}
+		return convertNetworkLoadBalancer(created), nil
+	}
+	if !actual.Ready() {
+		return actual, nil
+	}
+
+	if !slices.Equal(actual.IPs, desired.IPs) || actual.ListenerLan != desired.ListenerLan || actual.TargetLan != desired.TargetLan {
+		klog.Infof("updating network load balancer %s", desired.Name)
+		_, _, err := a.client.NetworkLoadBalancersApi.DatacentersNetworkloadbalancersPatch(ctx, a.DatacenterId, actual.ID).
+			NetworkLoadBalancerProperties(ionoscloud.NetworkLoadBalancerProperties{
+				Ips:         &desired.IPs,
+				ListenerLan: ionoscloud.PtrInt32(desired.ListenerLan),
+				TargetLan:   ionoscloud.PtrInt32(desired.TargetLan),
+			}).Execute()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := a.syncForwardingRules(ctx, actual, desired.Rules); err != nil {
+		return nil, err
+	}
+	return a.GetNetworkLoadBalancer(ctx, desired.Name)
+}
+
+// syncForwardingRules creates, replaces and deletes the forwarding rules of
+// nlb to match the desired rules by name.
+func (a *IONOSClient) syncForwardingRules(ctx context.Context, nlb *NetworkLoadBalancer, desired []ForwardingRule) error {
+	api := a.client.NetworkLoadBalancersApi
+	existing := map[string]ForwardingRule{}
+	for _, rule := range nlb.Rules {
+		existing[rule.Name] = rule
+	}
+	for _, rule := range desired {
+		actual, ok := existing[rule.Name]
+		delete(existing, rule.Name)
+		switch {
+		case !ok:
+			klog.Infof("creating forwarding rule %s of network load balancer %s", rule.Name, nlb.Name)
+			_, _, err := api.DatacentersNetworkloadbalancersForwardingrulesPost(ctx, a.DatacenterId, nlb.ID).
+				NetworkLoadBalancerForwardingRule(ionoscloud.NetworkLoadBalancerForwardingRule{Properties: forwardingRuleProperties(rule)}).
+				Execute()
+			if err != nil {
+				return fmt.Errorf("failed to create forwarding rule %s: %w", rule.Name, err)
+			}
+		case !forwardingRuleEqual(actual, rule):
+			klog.Infof("replacing forwarding rule %s of network load balancer %s", rule.Name, nlb.Name)
+			_, _, err := api.DatacentersNetworkloadbalancersForwardingrulesPut(ctx, a.DatacenterId, nlb.ID, actual.ID).
+				NetworkLoadBalancerForwardingRule(ionoscloud.NetworkLoadBalancerForwardingRulePut{Properties: forwardingRuleProperties(rule)}).
+				Execute()
+			if err != nil {
+				return fmt.Errorf("failed to replace forwarding rule %s: %w", rule.Name, err)
+			}
+		}
+	}
+	for _, rule := range existing {
+		klog.Infof("deleting forwarding rule %s of network load balancer %s", rule.Name, nlb.Name)
+		if _, err := api.DatacentersNetworkloadbalancersForwardingrulesDelete(ctx, a.DatacenterId, nlb.ID, rule.ID).Execute(); err != nil {
+			return fmt.Errorf("failed to delete forwarding rule %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteNetworkLoadBalancer deletes the Network Load Balancer called name
+// including its forwarding rules. Deleting a missing load balancer succeeds.
+func (a *IONOSClient) DeleteNetworkLoadBalancer(ctx context.Context, name string) error {
+	nlb, err := a.GetNetworkLoadBalancer(ctx, name)
+	if err != nil || nlb == nil {
+		return err
+	}
+	klog.Infof("deleting network load balancer %s in datacenter %s", name, a.DatacenterId)
+	resp, err := a.client.NetworkLoadBalancersApi.DatacentersNetworkloadbalancersDelete(ctx, a.DatacenterId, nlb.ID).Execute()
+	if err != nil && !isNotFound(resp) {
+		return err
+	}
+	return nil
+}
+
+func forwardingRuleProperties(rule ForwardingRule) *ionoscloud.NetworkLoadBalancerForwardingRuleProperties {
+	targets := make([]ionoscloud.NetworkLoadBalancerForwardingRuleTarget, 0, len(rule.Targets))
+	for _, target := range rule.Targets {
+		targets = append(targets, ionoscloud.NetworkLoadBalancerForwardingRuleTarget{
+			Ip:     ionoscloud.PtrString(target.IP),
+			Port:   ionoscloud.PtrInt32(target.Port),
+			Weight: ionoscloud.PtrInt32(nlbTargetWeight),
+			HealthCheck: &ionoscloud.NetworkLoadBalancerForwardingRuleTargetHealthCheck{
+				Check:         ionoscloud.PtrBool(true),
+				CheckInterval: ionoscloud.PtrInt32(nlbCheckInterval),
+			},
+		})
+	}
+	return &ionoscloud.NetworkLoadBalancerForwardingRuleProperties{
+		Name:         ionoscloud.PtrString(rule.Name),
+		Algorithm:    ionoscloud.PtrString(nlbAlgorithm),
+		Protocol:     ionoscloud.PtrString(rule.Protocol),
+		ListenerIp:   ionoscloud.PtrString(rule.ListenerIP),
+		ListenerPort: ionoscloud.PtrInt32(rule.ListenerPort),
+		Targets:      &targets,
+	}
+}
+
+func forwardingRuleEqual(a, b ForwardingRule) bool {
+	return a.Protocol == b.Protocol && a.ListenerIP == b.ListenerIP && a.ListenerPort == b.ListenerPort &&
+		slices.Equal(sortedTargets(a.Targets), sortedTargets(b.Targets))
+}
+
+func sortedTargets(targets []ForwardingTarget) []ForwardingTarget {
+	sorted := slices.Clone(targets)
+	slices.SortFunc(sorted, func(a, b ForwardingTarget) int {
+		return cmp.Or(cmp.Compare(a.IP, b.IP), cmp.Compare(a.Port, b.Port))
+	})
+	return sorted
+}
+
+func convertNetworkLoadBalancer(nlb ionoscloud.NetworkLoadBalancer) *NetworkLoadBalancer {
+	n := &NetworkLoadBalancer{ID: stringValue(nlb.Id)}
+	if nlb.Metadata != nil {
+		n.State = stringValue(nlb.Metadata.State)
+	}
+	if p := nlb.Properties; p != nil {
+		n.Name = stringValue(p.Name)
+		if p.Ips != nil {
+			n.IPs = *p.Ips
+		}
+		if p.ListenerLan != nil {
+			n.ListenerLan = *p.ListenerLan
+		}
+		if p.TargetLan != nil {
+			n.TargetLan = *p.TargetLan
+		}
+	}
+	if nlb.Entities == nil || nlb.Entities.Forwardingrules == nil || nlb.Entities.Forwardingrules.Items == nil {
+		return n
+	}
+	for _, rule := range *nlb.Entities.Forwardingrules.Items {
+		p := rule.Properties
+		if p == nil {
+			continue
+		}
+		r := ForwardingRule{
+			ID:         stringValue(rule.Id),
+			Name:       stringValue(p.Name),
+			Protocol:   stringValue(p.Protocol),
+			ListenerIP: stringValue(p.ListenerIp),
+		}
+		if p.ListenerPort != nil {
+			r.ListenerPort = *p.ListenerPort
+		}
+		if p.Targets != nil {
+			for _, target := range *p.Targets {
+				t := ForwardingTarget{IP: stringValue(target.Ip)}
+				if target.Port != nil {
+					t.Port = *target.Port
+				}
+				r.Targets = append(r.Targets, t)
+			}
+		}
+		n.Rules = append(n.Rules, r)
+	}
+	return n
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// ProviderID identifies a server by its provider ID. Legacy provider IDs of the
+// form ionos://<serverID> have no DatacenterID, datacenter-qualified ones are of
+// the form ionos://<datacenterID>/<serverID>.
+type ProviderID struct {
+	DatacenterID string
+	ServerID     string
+}
+
+// ParseProviderID parses legacy and datacenter-qualified provider IDs. Server
+// IDs are lowercased, while datacenter IDs are kept as they are, as they have
+// to match the keys of the token secret.
+func ParseProviderID(providerID string) (ProviderID, error) {
+	withoutPrefix, ok := strings.CutPrefix(strings.TrimSpace(providerID), config.ProviderPrefix)
+	if !ok {
+		return ProviderID{}, fmt.Errorf("provider ID %q does not start with %q", providerID, config.ProviderPrefix)
+	}
+
+	var id ProviderID
+	parts := strings.Split(withoutPrefix, "/")
+	switch len(parts) {
+	case 1:
+		id.ServerID = strings.ToLower(parts[0])
+	case 2:
+		id.DatacenterID, id.ServerID = parts[0], strings.ToLower(parts[1])
+		if err := uuid.Validate(id.DatacenterID); err != nil {
+			return ProviderID{}, fmt.Errorf("provider ID %q has an invalid datacenter ID: %w", providerID, err)
+		}
+	default:
+		return ProviderID{}, fmt.Errorf("provider ID %q must be of the form %s[<datacenterID>/]<serverID>", providerID, config.ProviderPrefix)
+	}
+	if err := uuid.Validate(id.ServerID); err != nil {
+		return ProviderID{}, fmt.Errorf("provider ID %q has an invalid server ID: %w", providerID, err)
+	}
+	return id, nil
+}
+
+func (p ProviderID) String() string {
+	if p.DatacenterID == "" {
+		return config.ProviderPrefix + p.ServerID
+	}
+	return fmt.Sprintf("%s%s/%s", config.ProviderPrefix, p.DatacenterID, p.ServerID)
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	ionoscloud "github.com/ionos-cloud/sdk-go/v6"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const labelResourceTypeServer = "server"
+
+// serverScope decides whether a server belongs to the cluster.
+type serverScope func(server *ionoscloud.Server) bool
+
+// serverScope returns the scope of the servers belonging to the cluster.
+func (a *IONOSClient) serverScope(ctx context.Context) (serverScope, error) {
+	scope := a.options.Scope
+	var labeled sets.Set[string]
+	if scope.ClusterLabel != "" {
+		var err error
+		if labeled, err = a.labeledResources(ctx, labelResourceTypeServer, scope.ClusterLabel, a.options.ClusterID); err != nil {
+			return nil, fmt.Errorf("failed to list servers labeled %s=%s: %w", scope.ClusterLabel, a.options.ClusterID, err)
+		}
+	}
+	return func(server *ionoscloud.Server) bool {
+		if labeled != nil && !labeled.Has(stringValue(server.Id)) {
+			return false
+		}
+		if scope.NamePrefix != "" && (server.Properties == nil || !strings.HasPrefix(stringValue(server.Properties.Name), scope.NamePrefix)) {
+			return false
+		}
+		if len(scope.LanIDs) > 0 && !inLANs(server, scope.LanIDs) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// labeledResources returns the IDs of the resources of resourceType carrying
+// the label key=value.
+func (a *IONOSClient) labeledResources(ctx context.Context, resourceType, key, value string) (sets.Set[string], error) {
+	labels, _, err := a.client.LabelsApi.LabelsGet(ctx).Depth(1).Filter("key", key).Filter("value", value).Execute()
+	if err != nil {
+		return nil, err
+	}
+	ids := sets.New[string]()
+	if labels.Items == nil {
+		return ids, nil
+	}
+	for _, label := range *labels.Items {
+		p := label.Properties
+		if p == nil || stringValue(p.ResourceType) != resourceType || stringValue(p.Key) != key || stringValue(p.Value) != value {
+			continue
+		}
+		ids.Insert(stringValue(p.ResourceId))
+	}
+	return ids, nil
+}
+
+func inLANs(server *ionoscloud.Server, lanIDs []int32) bool {
+	if server.Entities == nil || !server.Entities.HasNics() {
+		return false
+	}
+	for _, nic := range *server.Entities.Nics.Items {
+		if nic.Properties != nil && nic.Properties.Lan != nil && slices.Contains(lanIDs, *nic.Properties.Lan) {
+			return true
+		}
+	}
+	return false
+}
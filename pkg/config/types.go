@@ -1,5 +1,12 @@
 package config
 
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 const (
 	// RegisteredProviderName is the name of the cloud provider registered with
 	// Kubernetes.
@@ -7,9 +14,285 @@ const (
 	ProviderPrefix         = "ionos://"
 	// ClientName is the user agent passed into the controller client builder.
 	ClientName = "ionoscloud-cloud-controller-manager"
+
+	// ProviderIDFormatLegacy formats provider IDs as ionos://<serverID>.
+	ProviderIDFormatLegacy = "legacy"
+	// ProviderIDFormatDatacenter formats provider IDs as ionos://<datacenterID>/<serverID>.
+	ProviderIDFormatDatacenter = "datacenter"
+
+	// LoadBalancerModeFailoverIP attaches the load balancer IP to the NIC of one node.
+	LoadBalancerModeFailoverIP = "failover-ip"
+	// LoadBalancerModeNLB provisions an IONOS Network Load Balancer per Service.
+	LoadBalancerModeNLB = "nlb"
+	// LoadBalancerModeALB provisions an IONOS Application Load Balancer per
+	// Service.
+	LoadBalancerModeALB = "alb"
+	// LoadBalancerModeIPAM only manages the load balancer IP and reports it in
+	// the Service status, leaving it to others to announce it.
+	LoadBalancerModeIPAM = "ipam"
+
+	// LocalEndpointsPrefer elects nodes hosting endpoints of a Service with
+	// externalTrafficPolicy Local if there are any.
+	LocalEndpointsPrefer = "prefer"
+	// LocalEndpointsRequire only elects nodes hosting endpoints of a Service
+	// with externalTrafficPolicy Local.
+	LocalEndpointsRequire = "require"
+
+	// PlacementBalanced places failover IPs on the node with the least
+	// weighted number of IPs, breaking ties by rendezvous hashing.
+	PlacementBalanced = "balanced"
+	// PlacementRendezvous places failover IPs by rendezvous hashing of the
+	// Service and node names only.
+	PlacementRendezvous = "rendezvous"
 )
 
 type Config struct {
 	TokenSecretName      string `json:"tokenSecretName"`
 	TokenSecretNamespace string `json:"tokenSecretNamespace"`
+	// ClusterID identifies the IONOS resources owned by this cluster.
+	ClusterID string      `json:"clusterID,omitempty"`
+	Scope     ScopeConfig `json:"scope"`
+	Zones     ZoneConfig  `json:"zones"`
+	// ProviderIDFormat is the format of provider IDs reported for new nodes,
+	// either ProviderIDFormatLegacy (default) or ProviderIDFormatDatacenter.
+	// Both formats are accepted regardless of this setting.
+	ProviderIDFormat string `json:"providerIDFormat,omitempty"`
+	// DiscoveryParallelism limits how many datacenters are queried
+	// concurrently when looking up a node. Defaults to 4.
+	DiscoveryParallelism int `json:"discoveryParallelism,omitempty"`
+	// Lifecycle maps IONOS server states to node lifecycle semantics.
+	Lifecycle LifecycleConfig `json:"lifecycle"`
+	// Deletion guards against deleting nodes because of transient API errors.
+	Deletion DeletionConfig `json:"deletion"`
+	// Datacenters configures datacenter specific behavior by datacenter ID.
+	Datacenters map[string]DatacenterConfig `json:"datacenters,omitempty"`
+	// LoadBalancer configures the load balancer implementation.
+	LoadBalancer LoadBalancerConfig `json:"loadBalancer"`
+}
+
+// ScopeConfig restricts which servers of a datacenter belong to the cluster
+// when looking up nodes by name or IP and load balancer IPs. All criteria
+// which are set have to match. Lookups by provider ID are not scoped.
+type ScopeConfig struct {
+	// ClusterLabel is the key of an IONOS server label whose value has to be
+	// the ClusterID.
+	ClusterLabel string `json:"clusterLabel,omitempty"`
+	// LanIDs are LANs of which a server has to be member of at least one.
+	LanIDs []int32 `json:"lanIds,omitempty"`
+	// NamePrefix is a prefix server names have to start with.
+	NamePrefix string `json:"namePrefix,omitempty"`
+}
+
+// ZoneConfig controls how IONOS availability zones are reported as Kubernetes
+// topology zones.
+type ZoneConfig struct {
+	// Mapping renames IONOS availability zones (AUTO, ZONE_1, ZONE_2), e.g.
+	// ZONE_1 to de-fra-1a. Servers in AUTO are reported without a zone unless
+	// AUTO is mapped explicitly, as IONOS does not expose the resolved zone.
+	Mapping map[string]string `json:"mapping,omitempty"`
+	// PerDatacenter reports every datacenter as its own zone, which is useful
+	// for clusters spanning multiple datacenters.
+	PerDatacenter bool `json:"perDatacenter,omitempty"`
+	// Datacenters maps datacenter IDs to zone names if PerDatacenter is set.
+	// Datacenters without an entry are reported by their ID.
+	Datacenters map[string]string `json:"datacenters,omitempty"`
+}
+
+// LifecycleConfig maps IONOS server states to the shutdown and existence
+// semantics of the node lifecycle controller. Omitted lists use the defaults,
+// empty lists configure no state.
+type LifecycleConfig struct {
+	// ShutdownVMStates are VM states reported as shut down. Defaults to
+	// PAUSED, SHUTDOWN, SHUTOFF, CRASHED and SUSPENDED (stopped Cubes).
+	ShutdownVMStates []string `json:"shutdownVMStates,omitempty"`
+	// ShutdownStates are resource states reported as shut down regardless of
+	// the VM state. Defaults to INACTIVE, DEPROVISIONING and FAILED.
+	ShutdownStates []string `json:"shutdownStates,omitempty"`
+	// DeletedStates are resource states for which the instance is reported as
+	// no longer existing, e.g. DEPROVISIONING. Defaults to none.
+	DeletedStates []string `json:"deletedStates,omitempty"`
+}
+
+// DeletionConfig controls how long a server has to be missing before its
+// node is reported as deleted.
+type DeletionConfig struct {
+	// GracePeriod is the minimum time a server has to be missing, e.g. "5m".
+	// Defaults to 5 minutes.
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+	// Confirmations is the number of consecutive checks which have to confirm
+	// the server is missing. Defaults to 3.
+	Confirmations int `json:"confirmations,omitempty"`
+}
+
+// LoadBalancerConfig configures the load balancer implementation.
+type LoadBalancerConfig struct {
+	// Mode is the default load balancer implementation of Services,
+	// LoadBalancerModeFailoverIP (default), LoadBalancerModeNLB,
+	// LoadBalancerModeALB or LoadBalancerModeIPAM. Services annotated for
+	// layer 7 default to LoadBalancerModeALB.
+	Mode string `json:"mode,omitempty"`
+	// DatacenterID is the datacenter in whose location IP blocks are reserved
+	// for failover IPs. Defaults to the only configured datacenter.
+	DatacenterID string `json:"datacenterID,omitempty"`
+	// LocalEndpoints is the default policy for electing nodes for Services
+	// with externalTrafficPolicy Local, LocalEndpointsPrefer (default) or
+	// LocalEndpointsRequire.
+	LocalEndpoints string `json:"localEndpoints,omitempty"`
+	// Placement is the strategy picking the node of a failover IP,
+	// PlacementBalanced (default) or PlacementRendezvous.
+	Placement string `json:"placement,omitempty"`
+	// NodeSelector is a label selector, e.g. "node-role.kubernetes.io/edge",
+	// restricting the nodes failover IPs are attached to.
+	NodeSelector string `json:"nodeSelector,omitempty"`
+	// HealthCheck configures active probing of nodes for failover IPs.
+	HealthCheck HealthCheckConfig `json:"healthCheck"`
+	// Failover configures how fast failover IPs move away from failing nodes.
+	Failover FailoverConfig `json:"failover"`
+	// GarbageCollection configures removing orphaned failover IPs.
+	GarbageCollection GarbageCollectionConfig `json:"garbageCollection"`
+	// DriftRepair configures repairing failover IPs changed outside the
+	// provider.
+	DriftRepair DriftRepairConfig `json:"driftRepair"`
+	// NLB configures the managed Network Load Balancers.
+	NLB ManagedLoadBalancerConfig `json:"nlb"`
+	// ALB configures the managed Application Load Balancers.
+	ALB ManagedLoadBalancerConfig `json:"alb"`
+}
+
+// HealthCheckConfig configures probing nodes before they are elected for or
+// keep a failover IP. A node is probed on /healthz of the kube-proxy or, for
+// Services with externalTrafficPolicy Local, the health check node port, and
+// IONOS has to report its VM as running.
+type HealthCheckConfig struct {
+	// Enabled turns probing on. Otherwise only the NodeReady condition is
+	// considered.
+	Enabled bool `json:"enabled,omitempty"`
+	// Port is the kube-proxy healthz port. Defaults to 10256.
+	Port int32 `json:"port,omitempty"`
+	// Timeout is the timeout of a single probe, e.g. "2s". Defaults to 2
+	// seconds.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// FailureThreshold is the number of consecutive failed probes after which
+	// a healthy node is considered unhealthy. Defaults to 2.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// SuccessThreshold is the number of consecutive successful probes after
+	// which an unhealthy node is considered healthy again. Defaults to 2.
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+}
+
+// FailoverConfig configures the reaction delays of the failover controller,
+// which moves failover IPs away from failing nodes. A node recovering within
+// the delay keeps its IPs.
+type FailoverConfig struct {
+	// NotReadyDelay is the delay after a node became not ready, e.g. "10s".
+	// Defaults to 0.
+	NotReadyDelay metav1.Duration `json:"notReadyDelay,omitempty"`
+	// CordonDelay is the delay after a node was cordoned. Defaults to 0.
+	CordonDelay metav1.Duration `json:"cordonDelay,omitempty"`
+	// ServerDownDelay is the delay after the server of a node was found not
+	// running. Defaults to 0.
+	ServerDownDelay metav1.Duration `json:"serverDownDelay,omitempty"`
+	// ServerStateInterval is the interval the state of the servers is polled
+	// in. Defaults to 30 seconds.
+	ServerStateInterval metav1.Duration `json:"serverStateInterval,omitempty"`
+	// MinHoldTime is the minimum time a node holds a failover IP before it
+	// returns to its home node or moves to the preferred zone. Failing nodes
+	// lose their IPs regardless. Defaults to 0.
+	MinHoldTime metav1.Duration `json:"minHoldTime,omitempty"`
+	// ReturnAfter is the time a node an IP was failed over from has to be
+	// ready before the IP returns to it. Defaults to 0, which disables
+	// returning.
+	ReturnAfter metav1.Duration `json:"returnAfter,omitempty"`
+	// MaxMovesPerService limits the moves of the IP of a Service within the
+	// MoveWindow. Defaults to 0, which is unlimited.
+	MaxMovesPerService int `json:"maxMovesPerService,omitempty"`
+	// MaxMovesPerCluster limits the moves of all IPs within the MoveWindow.
+	// Defaults to 0, which is unlimited.
+	MaxMovesPerCluster int `json:"maxMovesPerCluster,omitempty"`
+	// MoveWindow is the window of the move limits. Defaults to 10 minutes.
+	MoveWindow metav1.Duration `json:"moveWindow,omitempty"`
+}
+
+// GarbageCollectionConfig configures the periodic removal of failover IPs
+// which are attached to servers although no Service owns them anymore. Only
+// IPs the provider attached itself are removed.
+type GarbageCollectionConfig struct {
+	// Enabled turns garbage collection on.
+	Enabled bool `json:"enabled,omitempty"`
+	// Interval is the interval garbage is collected in. Defaults to 10
+	// minutes.
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// GracePeriod is the time an IP has to be orphaned before it is removed.
+	// Defaults to 30 minutes.
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+	// DryRun only reports the orphaned IPs which would be removed.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// DriftRepairConfig configures the periodic verification that the failover IP
+// of every Service is attached to exactly one eligible node.
+type DriftRepairConfig struct {
+	// Enabled turns drift repair on.
+	Enabled bool `json:"enabled,omitempty"`
+	// Interval is the interval the IPs are verified in. Defaults to 5
+	// minutes.
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+// ManagedLoadBalancerConfig configures load balancers managed by IONOS.
+type ManagedLoadBalancerConfig struct {
+	// DatacenterID is the datacenter load balancers are created in. Defaults
+	// to the only configured datacenter.
+	DatacenterID string `json:"datacenterID,omitempty"`
+	// ListenerLan is the public LAN the load balancer IP is exposed in.
+	ListenerLan int32 `json:"listenerLan"`
+	// TargetLan is the LAN the load balancer reaches the nodes in.
+	TargetLan int32 `json:"targetLan"`
+}
+
+// IsConfigured reports whether the LANs of the load balancers are set.
+func (c ManagedLoadBalancerConfig) IsConfigured() bool {
+	return c.ListenerLan != 0 && c.TargetLan != 0
+}
+
+// DatacenterConfig configures the behavior for a single datacenter.
+type DatacenterConfig struct {
+	// PrimaryNIC selects the NIC load balancer IPs are attached to. Defaults
+	// to the NIC in PCI slot 6, the first NIC of a server.
+	PrimaryNIC NICSelector `json:"primaryNIC"`
+}
+
+// NICSelector selects a NIC of a server. All criteria which are set have to
+// match.
+type NICSelector struct {
+	// ID is the ID of the NIC.
+	ID string `json:"id,omitempty"`
+	// LanID is the ID of the LAN the NIC is connected to.
+	LanID *int32 `json:"lanId,omitempty"`
+	// NamePattern is a regular expression the NIC name has to match.
+	NamePattern string `json:"namePattern,omitempty"`
+	// PCISlot is the PCI slot of the NIC.
+	PCISlot *int32 `json:"pciSlot,omitempty"`
+}
+
+// IsEmpty reports whether no criteria are set.
+func (s NICSelector) IsEmpty() bool {
+	return s.ID == "" && s.LanID == nil && s.NamePattern == "" && s.PCISlot == nil
+}
+
+func (s NICSelector) String() string {
+	var criteria []string
+	if s.ID != "" {
+		criteria = append(criteria, "id="+s.ID)
+	}
+	if s.LanID != nil {
+		criteria = append(criteria, fmt.Sprintf("lanId=%d", *s.LanID))
+	}
+	if s.NamePattern != "" {
+		criteria = append(criteria, fmt.Sprintf("namePattern=%q", s.NamePattern))
+	}
+	if s.PCISlot != nil {
+		criteria = append(criteria, fmt.Sprintf("pciSlot=%d", *s.PCISlot))
+	}
+	return "{" + strings.Join(criteria, ", ") + "}"
 }
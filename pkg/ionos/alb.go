@@ -0,0 +1,181 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+const defaultRedirectCode = 301
+
+var redirectCodes = []int32{301, 302, 303, 307, 308}
+
+// applicationLoadBalancer provisions an IONOS Application Load Balancer per
+// Service. Every Service port gets a target group with the NodePort of all
+// eligible nodes and an HTTP rule derived from the Service annotations.
+type applicationLoadBalancer struct {
+	config       config.ManagedLoadBalancerConfig
+	ionosClients map[string]*client2.IONOSClient
+}
+
+func (a applicationLoadBalancer) GetLoadBalancer(ctx context.Context, name string) (*v1.LoadBalancerStatus, bool, error) {
+	client, err := datacenterClient(a.ionosClients, a.config.DatacenterID)
+	if err != nil {
+		return nil, false, err
+	}
+	alb, err := client.GetApplicationLoadBalancer(ctx, name)
+	if err != nil || alb == nil {
+		return nil, false, err
+	}
+	return ingressStatus(alb.IPs), true, nil
+}
+
+func (a applicationLoadBalancer) EnsureLoadBalancer(ctx context.Context, name, loadBalancerIP string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	klog.Infof("ensureApplicationLoadBalancer %s (service %s/%s)", name, service.Namespace, service.Name)
+	if !a.config.IsConfigured() {
+		return nil, errors.New("application load balancers require loadBalancer.alb.listenerLan and targetLan in the cloud config")
+	}
+	client, err := datacenterClient(a.ionosClients, a.config.DatacenterID)
+	if err != nil {
+		return nil, err
+	}
+	template, err := httpRuleFromAnnotations(service)
+	if err != nil {
+		return nil, err
+	}
+	targets := nodeTargets(nodes, a.config.TargetLan)
+	if len(targets) == 0 {
+		return nil, errors.New("no valid nodes found")
+	}
+
+	desired := client2.ApplicationLoadBalancer{
+		Name:        name,
+		IPs:         []string{loadBalancerIP},
+		ListenerLan: a.config.ListenerLan,
+		TargetLan:   a.config.TargetLan,
+	}
+	var groups []string
+	for _, port := range service.Spec.Ports {
+		if port.Protocol != v1.ProtocolTCP {
+			return nil, fmt.Errorf("port %d: protocol %s is not supported by application load balancers", port.Port, port.Protocol)
+		}
+		rule := template
+		rule.Name = fmt.Sprintf("http-%d", port.Port)
+		if rule.Type == client2.HTTPRuleForward {
+			groupName := targetGroupName(name, port.Port)
+			groupTargets := make([]client2.ForwardingTarget, 0, len(targets))
+			for _, ip := range targets {
+				groupTargets = append(groupTargets, client2.ForwardingTarget{IP: ip, Port: port.NodePort})
+			}
+			group, err := client.EnsureTargetGroup(ctx, groupName, groupTargets)
+			if err != nil {
+				return nil, fmt.Errorf("failed to ensure target group %s: %w", groupName, err)
+			}
+			if !group.Ready() {
+				return nil, cloudproviderapi.NewRetryError(fmt.Sprintf("target group %s is %s", groupName, group.State), provisioningRetryDelay)
+			}
+			rule.TargetGroupID = group.ID
+			groups = append(groups, groupName)
+		}
+		desired.Rules = append(desired.Rules, client2.HTTPForwardingRule{
+			Name:         rule.Name,
+			ListenerIP:   loadBalancerIP,
+			ListenerPort: port.Port,
+			HTTPRules:    []client2.HTTPRule{rule},
+		})
+	}
+
+	alb, err := client.EnsureApplicationLoadBalancer(ctx, desired)
+	if err != nil {
+		return nil, err
+	}
+	if !alb.Ready() {
+		return nil, cloudproviderapi.NewRetryError(fmt.Sprintf("application load balancer %s is %s", name, alb.State), provisioningRetryDelay)
+	}
+	if err := a.deleteTargetGroups(ctx, client, name, groups); err != nil {
+		return nil, err
+	}
+	return ingressStatus(alb.IPs), nil
+}
+
+func (a applicationLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, name string) error {
+	klog.Infof("ensureApplicationLoadBalancerDeleted %s", name)
+	client, err := datacenterClient(a.ionosClients, a.config.DatacenterID)
+	if err != nil {
+		return err
+	}
+	alb, err := client.GetApplicationLoadBalancer(ctx, name)
+	if err != nil {
+		return err
+	}
+	if alb != nil {
+		// Target groups can only be deleted once no load balancer uses them.
+		if alb.Ready() {
+			if err := client.DeleteApplicationLoadBalancer(ctx, alb.ID); err != nil {
+				return err
+			}
+		}
+		return cloudproviderapi.NewRetryError(fmt.Sprintf("application load balancer %s is being deleted", name), provisioningRetryDelay)
+	}
+	return a.deleteTargetGroups(ctx, client, name, nil)
+}
+
+// deleteTargetGroups deletes the target groups of the load balancer called
+// name which are not in keep.
+func (a applicationLoadBalancer) deleteTargetGroups(ctx context.Context, client *client2.IONOSClient, name string, keep []string) error {
+	groups, err := client.ListTargetGroups(ctx, name+"-")
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if slices.Contains(keep, group.Name) {
+			continue
+		}
+		klog.Infof("deleting target group %s of application load balancer %s", group.Name, name)
+		if err := client.DeleteTargetGroup(ctx, group.ID); err != nil {
+			return fmt.Errorf("failed to delete target group %s: %w", group.Name, err)
+		}
+	}
+	return nil
+}
+
+func targetGroupName(name string, port int32) string {
+	return fmt.Sprintf("%s-%d", name, port)
+}
+
+// httpRuleFromAnnotations returns the HTTP rule applied to every port of the
+// service, forwarding to the nodes unless a redirect is annotated.
+func httpRuleFromAnnotations(service *v1.Service) (client2.HTTPRule, error) {
+	rule := client2.HTTPRule{
+		Type: client2.HTTPRuleForward,
+		Host: service.Annotations[annotationALBHost],
+		Path: service.Annotations[annotationALBPath],
+	}
+	location, ok := service.Annotations[annotationALBRedirect]
+	if !ok {
+		return rule, nil
+	}
+	if location == "" {
+		return rule, fmt.Errorf("annotation %s must not be empty", annotationALBRedirect)
+	}
+	rule.Type = client2.HTTPRuleRedirect
+	rule.Location = location
+	rule.StatusCode = defaultRedirectCode
+	if value, ok := service.Annotations[annotationALBRedirectCode]; ok {
+		code, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || !slices.Contains(redirectCodes, int32(code)) {
+			return rule, fmt.Errorf("annotation %s must be one of %v, got %q", annotationALBRedirectCode, redirectCodes, value)
+		}
+		rule.StatusCode = int32(code)
+	}
+	return rule, nil
+}
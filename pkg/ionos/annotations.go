@@ -0,0 +1,62 @@
+package ionos
+
+const (
+	// annotationNICs is a JSON list describing the NICs of a node's server.
+	annotationNICs = "ionos.cloud/nics"
+	// annotationPrimaryNIC overrides the NIC load balancer IPs are attached to
+	// on a node, given as NIC ID or NIC name.
+	annotationPrimaryNIC = "ionos.cloud/primary-nic"
+
+	// annotationLoadBalancerMode selects the load balancer implementation of
+	// a Service, failover-ip, nlb, alb or ipam. Defaults to the mode of the
+	// cloud config.
+	annotationLoadBalancerMode = "ionos.cloud/load-balancer-mode"
+	// annotationLoadBalancerActiveMode records the mode the load balancer of
+	// a Service was last ready in. It is maintained by the controller.
+	annotationLoadBalancerActiveMode = "ionos.cloud/load-balancer-active-mode"
+	// annotationLocalEndpoints overrides the policy for electing nodes for a
+	// Service with externalTrafficPolicy Local, prefer or require.
+	annotationLocalEndpoints = "ionos.cloud/local-endpoints"
+	// annotationNodeSelector is a label selector restricting the nodes the
+	// failover IP of a Service is attached to, in addition to the node
+	// selector of the cloud config.
+	annotationNodeSelector = "ionos.cloud/node-selector"
+	// annotationLoadBalancerNode records the node the failover IP of a
+	// Service is attached to, which is used to balance the IPs over nodes.
+	annotationLoadBalancerNode = "ionos.cloud/load-balancer-node"
+	// annotationLoadBalancerHomeNode records the node the failover IP of a
+	// Service was failed over from, to which it returns once the node is
+	// stable again.
+	annotationLoadBalancerHomeNode = "ionos.cloud/load-balancer-home-node"
+	// annotationLoadBalancerWeight is the weight, 1 by default, a Service adds
+	// to the load of the node its failover IP is attached to.
+	annotationLoadBalancerWeight = "ionos.cloud/load-balancer-weight"
+	// annotationZone is the zone whose nodes are preferred for the failover
+	// IP of a Service.
+	annotationZone = "ionos.cloud/zone"
+	// annotationZoneSpreadGroup spreads the failover IPs of the Services of a
+	// namespace with the same group across zones.
+	annotationZoneSpreadGroup = "ionos.cloud/zone-spread-group"
+	// annotationIPPool allocates the load balancer IP of a Service from the
+	// IPPool with this name.
+	annotationIPPool = "ionos.cloud/ip-pool"
+	// annotationRetainIP keeps the IP block reserved for a Service when the
+	// Service is deleted.
+	annotationRetainIP = "ionos.cloud/retain-ip"
+	// annotationLoadBalancerLayer selects the OSI layer a Service is load
+	// balanced on, 4 (default) or 7. Layer 7 Services are served by an
+	// Application Load Balancer.
+	annotationLoadBalancerLayer = "ionos.cloud/load-balancer-layer"
+	// annotationALBHost restricts the HTTP rules of an Application Load
+	// Balancer to requests for this host.
+	annotationALBHost = "ionos.cloud/alb-host"
+	// annotationALBPath restricts the HTTP rules of an Application Load
+	// Balancer to requests whose path starts with this prefix.
+	annotationALBPath = "ionos.cloud/alb-path"
+	// annotationALBRedirect redirects matching requests to this location
+	// instead of forwarding them to the nodes.
+	annotationALBRedirect = "ionos.cloud/alb-redirect"
+	// annotationALBRedirectCode is the HTTP status code of redirects, 301
+	// (default), 302, 303, 307 or 308.
+	annotationALBRedirectCode = "ionos.cloud/alb-redirect-code"
+)
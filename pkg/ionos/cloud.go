@@ -3,21 +3,24 @@ package ionos
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"math/rand"
-	"time"
+	"regexp"
+	"sync/atomic"
 
 	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
 	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 )
 
 func init() {
 	cloudprovider.RegisterCloudProvider(config.RegisteredProviderName, func(cfg io.Reader) (cloudprovider.Interface, error) {
-		r := rand.New(rand.NewSource(time.Now().UnixNano()))
 		byConfig, err := io.ReadAll(cfg)
 		if err != nil {
 			klog.Errorf("ReadAll failed: %s", err)
@@ -28,33 +31,133 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
+		switch conf.ProviderIDFormat {
+		case "", config.ProviderIDFormatLegacy, config.ProviderIDFormatDatacenter:
+		default:
+			return nil, fmt.Errorf("unknown providerIDFormat %q", conf.ProviderIDFormat)
+		}
+		if conf.Scope.ClusterLabel != "" && conf.ClusterID == "" {
+			return nil, errors.New("scope.clusterLabel requires clusterID")
+		}
+		if err := validateLoadBalancerConfig(conf.LoadBalancer); err != nil {
+			return nil, err
+		}
+		for datacenterID, dc := range conf.Datacenters {
+			if _, err := regexp.Compile(dc.PrimaryNIC.NamePattern); err != nil {
+				return nil, fmt.Errorf("invalid primaryNIC.namePattern of datacenter %s: %w", datacenterID, err)
+			}
+		}
 
-		return newProvider(conf, r), nil
+		return newProvider(conf), nil
 	})
 }
 
 var _ cloudprovider.Interface = &IONOS{}
 
-func newProvider(config config.Config, r *rand.Rand) cloudprovider.Interface {
+func validateLoadBalancerConfig(cfg config.LoadBalancerConfig) error {
+	switch cfg.LocalEndpoints {
+	case "", config.LocalEndpointsPrefer, config.LocalEndpointsRequire:
+	default:
+		return fmt.Errorf("unknown loadBalancer.localEndpoints %q", cfg.LocalEndpoints)
+	}
+	switch cfg.Placement {
+	case "", config.PlacementBalanced, config.PlacementRendezvous:
+	default:
+		return fmt.Errorf("unknown loadBalancer.placement %q", cfg.Placement)
+	}
+	if _, err := labels.Parse(cfg.NodeSelector); err != nil {
+		return fmt.Errorf("invalid loadBalancer.nodeSelector: %w", err)
+	}
+	switch cfg.Mode {
+	case "", config.LoadBalancerModeFailoverIP, config.LoadBalancerModeIPAM:
+	case config.LoadBalancerModeNLB:
+		if !cfg.NLB.IsConfigured() {
+			return errors.New("loadBalancer.nlb requires listenerLan and targetLan")
+		}
+	case config.LoadBalancerModeALB:
+		if !cfg.ALB.IsConfigured() {
+			return errors.New("loadBalancer.alb requires listenerLan and targetLan")
+		}
+	default:
+		return fmt.Errorf("unknown loadBalancer.mode %q", cfg.Mode)
+	}
+	return nil
+}
+
+func newProvider(cfg config.Config) cloudprovider.Interface {
+	rec := &recorder{}
+	kc := &kubeClient{}
+	if cfg.ClusterID == "" {
+		klog.Warning("clusterID is not configured: load balancer IPs and servers of other clusters in the contract " +
+			"cannot be told apart, configure clusterID if several clusters share the contract")
+	}
+	clientOptions := client2.Options{
+		QualifiedProviderID: cfg.ProviderIDFormat == config.ProviderIDFormatDatacenter,
+		ClusterID:           cfg.ClusterID,
+		Scope:               cfg.Scope,
+	}
+	lbClients := map[string]*client2.IONOSClient{}
+	i := instances{
+		zoneConfig:    cfg.Zones,
+		clientOptions: clientOptions,
+		parallelism:   cfg.DiscoveryParallelism,
+		lifecycle:     newLifecycle(cfg.Lifecycle),
+		deletionGuard: newDeletionGuard(cfg.Deletion),
+		recorder:      rec,
+		kubeClient:    kc,
+		ionosClients:  map[string]*client2.IONOSClient{},
+	}
 	return IONOS{
-		config: config,
-		instances: instances{
-			ionosClients: map[string]*client2.IONOSClient{},
+		config:     cfg,
+		recorder:   rec,
+		kubeClient: kc,
+		instances:  i,
+		zones: zones{
+			instances: i,
 		},
 		loadbalancer: loadbalancer{
-			r:            r,
-			ionosClients: map[string]*client2.IONOSClient{},
+			config: cfg.LoadBalancer,
+			nlb: networkLoadBalancer{
+				config:       cfg.LoadBalancer.NLB,
+				ionosClients: lbClients,
+			},
+			alb: applicationLoadBalancer{
+				config:       cfg.LoadBalancer.ALB,
+				ionosClients: lbClients,
+			},
+			health:        newHealthProber(cfg.LoadBalancer.HealthCheck),
+			servers:       newFailureStates(cfg.LoadBalancer.Failover.ServerDownDelay),
+			notReady:      newFailureStates(cfg.LoadBalancer.Failover.NotReadyDelay),
+			cordoned:      newFailureStates(cfg.LoadBalancer.Failover.CordonDelay),
+			noEndpoints:   newFailureStates(metav1.Duration{}),
+			stale:         &staleHolders{},
+			hysteresis:    newHysteresis(cfg.LoadBalancer.Failover),
+			ledger:        newIPLedger(kc, cfg.TokenSecretNamespace),
+			clientOptions: clientOptions,
+			datacenters:   cfg.Datacenters,
+			recorder:      rec,
+			kubeClient:    kc,
+			listers:       &atomic.Pointer[listers]{},
+			locks:         &serviceLocks{},
+			ionosClients:  lbClients,
 		},
 	}
 }
 
-func (p IONOS) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, _ <-chan struct{}) {
+func (p IONOS) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
 	ctx := context.Background()
 	k8sClient, err := clientBuilder.Client(config.ClientName)
 	if err != nil {
 		klog.Errorf("Kubernetes Client Init Failed: %v", err)
 		return
 	}
+	p.kubeClient.Interface = k8sClient
+	p.recorder.start(k8sClient)
+	if restConfig, err := clientBuilder.Config(config.ClientName); err != nil {
+		klog.Errorf("Kubernetes Dynamic Client Init Failed: %v", err)
+	} else if p.kubeClient.dynamic, err = dynamic.NewForConfig(restConfig); err != nil {
+		klog.Errorf("Kubernetes Dynamic Client Init Failed: %v", err)
+	}
 	secret, err := k8sClient.CoreV1().Secrets(p.config.TokenSecretNamespace).Get(ctx, p.config.TokenSecretName, metav1.GetOptions{})
 	if err != nil {
 		klog.Errorf("Failed to get secret %s/%s: %v", p.config.TokenSecretNamespace, p.config.TokenSecretName, err)
@@ -74,6 +177,9 @@ func (p IONOS) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, _
 			return
 		}
 	}
+	// The controller reads the clients concurrently, so it is only started
+	// once all of them are added.
+	p.loadbalancer.startFailoverController(k8sClient, stop)
 }
 
 func (p IONOS) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
@@ -90,8 +196,7 @@ func (p IONOS) InstancesV2() (cloudprovider.InstancesV2, bool) {
 }
 
 func (p IONOS) Zones() (cloudprovider.Zones, bool) {
-	klog.Warning("The IONOS cloud provider does not support zones")
-	return nil, false
+	return p.zones, true
 }
 
 func (p IONOS) Clusters() (cloudprovider.Clusters, bool) {
@@ -108,6 +213,8 @@ func (p IONOS) ProviderName() string {
 	return config.RegisteredProviderName
 }
 
+// HasClusterID reports a cluster ID even if clusterID is not configured, as
+// deployments predating it would otherwise need --allow-untagged-cloud.
 func (p IONOS) HasClusterID() bool {
 	return true
 }
@@ -0,0 +1,433 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+const defaultServerStateInterval = 30 * time.Second
+
+// listers give access to the informer caches of the failover controller. They
+// are shared by value copies of the provider through an atomic pointer, which
+// is nil until the caches are synced.
+type listers struct {
+	services       corelisters.ServiceLister
+	nodes          corelisters.NodeLister
+	endpointSlices discoverylisters.EndpointSliceLister
+}
+
+// serviceLocks serializes syncs of the failover IP of a Service between the
+// service controller and the failover controller.
+type serviceLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (s *serviceLocks) lock(service *v1.Service) func() {
+	key := service.Namespace + "/" + service.Name
+	s.mu.Lock()
+	if s.locks == nil {
+		s.locks = map[string]*sync.Mutex{}
+	}
+	lock, ok := s.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[key] = lock
+	}
+	s.mu.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// failureStates tracks since when the failover controller found nodes
+// failing in one way, e.g. their server not running. A node is only
+// considered failed once the reaction delay passed. Services without local
+// endpoints are tracked the same way by their key.
+type failureStates struct {
+	delay time.Duration
+	now   func() time.Time
+
+	mu    sync.Mutex
+	since map[string]time.Time
+}
+
+func newFailureStates(delay metav1.Duration) *failureStates {
+	return &failureStates{
+		delay: max(delay.Duration, 0),
+		now:   time.Now,
+		since: map[string]time.Time{},
+	}
+}
+
+// set records whether the node is ok and reports whether that changed.
+func (s *failureStates) set(nodeName string, ok bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, failing := s.since[nodeName]
+	switch {
+	case ok && failing:
+		delete(s.since, nodeName)
+	case !ok && !failing:
+		s.since[nodeName] = s.now()
+	default:
+		return false
+	}
+	return true
+}
+
+// failed reports whether the node is failing for at least the delay.
+func (s *failureStates) failed(nodeName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since, ok := s.since[nodeName]
+	return ok && s.now().Sub(since) >= s.delay
+}
+
+// failing reports whether the node is failing, regardless of the delay.
+func (s *failureStates) failing(nodeName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.since[nodeName]
+	return ok
+}
+
+// pending reports whether the node is failing for less than the delay.
+func (s *failureStates) pending(nodeName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since, ok := s.since[nodeName]
+	return ok && s.now().Sub(since) < s.delay
+}
+
+// failoverController moves failover IPs on changes the service controller
+// does not react to in time, as it only syncs load balancers when a Service
+// or the set of nodes changes. It re-elects the holders of the IPs of a node
+// which becomes not ready, is cordoned, deleted or whose server stops running.
+type failoverController struct {
+	lb                  loadbalancer
+	queue               workqueue.TypedRateLimitingInterface[string]
+	listers             *listers
+	serverStateInterval time.Duration
+
+	gcEnabled     bool
+	gcInterval    time.Duration
+	gcGracePeriod time.Duration
+	gcDryRun      bool
+
+	driftEnabled  bool
+	driftInterval time.Duration
+	// orphanedSince is only accessed by the garbage collection loop.
+	orphanedSince map[string]time.Time
+}
+
+// startFailoverController starts the informers of the provider and the
+// failover controller, which runs until stop is closed.
+func (l loadbalancer) startFailoverController(k8sClient kubernetes.Interface, stop <-chan struct{}) {
+	factory := informers.NewSharedInformerFactory(k8sClient, 0)
+	services := factory.Core().V1().Services()
+	nodes := factory.Core().V1().Nodes()
+	endpointSlices := factory.Discovery().V1().EndpointSlices()
+
+	c := &failoverController{
+		lb:    l,
+		queue: workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		listers: &listers{
+			services:       services.Lister(),
+			nodes:          nodes.Lister(),
+			endpointSlices: endpointSlices.Lister(),
+		},
+		serverStateInterval: l.config.Failover.ServerStateInterval.Duration,
+		gcEnabled:           l.config.GarbageCollection.Enabled,
+		gcInterval:          l.config.GarbageCollection.Interval.Duration,
+		gcGracePeriod:       l.config.GarbageCollection.GracePeriod.Duration,
+		gcDryRun:            l.config.GarbageCollection.DryRun,
+		orphanedSince:       map[string]time.Time{},
+		driftEnabled:        l.config.DriftRepair.Enabled,
+		driftInterval:       l.config.DriftRepair.Interval.Duration,
+	}
+	if c.serverStateInterval <= 0 {
+		c.serverStateInterval = defaultServerStateInterval
+	}
+	if c.gcInterval <= 0 {
+		c.gcInterval = defaultGarbageCollectionInterval
+	}
+	if c.gcGracePeriod <= 0 {
+		c.gcGracePeriod = defaultGarbageCollectionGracePeriod
+	}
+	if c.driftInterval <= 0 {
+		c.driftInterval = defaultDriftRepairInterval
+	}
+	_, err := endpointSlices.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueEndpointSlice,
+		UpdateFunc: func(_, obj any) { c.enqueueEndpointSlice(obj) },
+		DeleteFunc: c.enqueueEndpointSlice,
+	})
+	if err != nil {
+		klog.Errorf("failed to watch endpoint slices: %v", err)
+		return
+	}
+	_, err = nodes.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if node, ok := obj.(*v1.Node); ok {
+				c.nodeAvailable(node.Name)
+			}
+		},
+		UpdateFunc: c.updateNode,
+		DeleteFunc: c.deleteNode,
+	})
+	if err != nil {
+		klog.Errorf("failed to watch nodes: %v", err)
+		return
+	}
+
+	factory.Start(stop)
+	go func() {
+		defer c.queue.ShutDown()
+		for informerType, ok := range factory.WaitForCacheSync(stop) {
+			if !ok {
+				klog.Errorf("failed to sync informer for %v", informerType)
+				return
+			}
+		}
+		l.listers.Store(c.listers)
+		klog.Info("failover controller started")
+		go c.run()
+		go wait.Until(c.checkServers, c.serverStateInterval, stop)
+		if c.gcEnabled {
+			go wait.Until(c.collectOrphanedIPs, c.gcInterval, stop)
+		}
+		if c.driftEnabled {
+			go wait.Until(c.repairDrift, c.driftInterval, stop)
+		}
+		<-stop
+	}()
+}
+
+func (c *failoverController) enqueueEndpointSlice(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	name := slice.Labels[discoveryv1.LabelServiceName]
+	if name == "" {
+		return
+	}
+	// Only the candidates of Services routing to local endpoints depend on
+	// the endpoints.
+	service, err := c.listers.services.Services(slice.Namespace).Get(name)
+	if err == nil && service.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyLocal {
+		c.queue.Add(slice.Namespace + "/" + name)
+	}
+}
+
+func (c *failoverController) updateNode(oldObj, newObj any) {
+	oldNode, ok := oldObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	node, ok := newObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	wasReady, ready := IsLoadBalancerCandidate(oldNode), IsLoadBalancerCandidate(node)
+	c.lb.notReady.set(node.Name, ready)
+	c.lb.cordoned.set(node.Name, !node.Spec.Unschedulable)
+	switch {
+	case wasReady && !ready:
+		klog.Infof("node %s is not ready, failing over its ips in %s", node.Name, c.lb.notReady.delay)
+		c.enqueueHeldBy(node.Name, c.lb.notReady.delay)
+	case !oldNode.Spec.Unschedulable && node.Spec.Unschedulable:
+		klog.Infof("node %s is cordoned, failing over its ips in %s", node.Name, c.lb.cordoned.delay)
+		c.enqueueHeldBy(node.Name, c.lb.cordoned.delay)
+	case !labels.Equals(oldNode.Labels, node.Labels):
+		c.enqueueHeldBy(node.Name, 0)
+		c.nodeAvailable(node.Name)
+	case !wasReady && ready, oldNode.Spec.Unschedulable && !node.Spec.Unschedulable:
+		c.nodeAvailable(node.Name)
+	}
+}
+
+func (c *failoverController) deleteNode(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if node, ok := obj.(*v1.Node); ok {
+		klog.Infof("node %s was deleted, failing over its ips", node.Name)
+		c.lb.notReady.set(node.Name, true)
+		c.lb.cordoned.set(node.Name, true)
+		c.enqueueHeldBy(node.Name, 0)
+	}
+}
+
+// enqueueHeldBy enqueues the Services whose failover IP is held by the node
+// after delay.
+func (c *failoverController) enqueueHeldBy(nodeName string, delay time.Duration) {
+	for _, service := range c.failoverServices() {
+		if service.Annotations[annotationLoadBalancerNode] == nodeName {
+			c.queue.AddAfter(service.Namespace+"/"+service.Name, delay)
+		}
+	}
+}
+
+// nodeAvailable enqueues the Services which may be placed on a node which
+// became available, those without a node and those preferring a zone. IPs
+// returning to the node are enqueued once it is stable and they were held
+// elsewhere for the minimum hold time.
+func (c *failoverController) nodeAvailable(nodeName string) {
+	returnAfter := max(c.lb.hysteresis.returnAfter, c.lb.hysteresis.minHoldTime)
+	for _, service := range c.failoverServices() {
+		key := service.Namespace + "/" + service.Name
+		_, placed := service.Annotations[annotationLoadBalancerNode]
+		_, zone := service.Annotations[annotationZone]
+		switch {
+		case !placed:
+			c.queue.Add(key)
+		case service.Annotations[annotationLoadBalancerHomeNode] == nodeName:
+			c.queue.AddAfter(key, returnAfter)
+		case zone:
+			c.queue.AddAfter(key, c.lb.hysteresis.minHoldTime)
+		}
+	}
+}
+
+// checkServers polls the state of the servers of all nodes and fails over the
+// IPs of nodes whose server stopped running.
+func (c *failoverController) checkServers() {
+	nodes, err := c.listers.nodes.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list nodes: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.serverStateInterval)
+	defer cancel()
+
+	var (
+		wg     sync.WaitGroup
+		tokens = make(chan struct{}, healthCheckParallelism)
+	)
+	for _, node := range nodes {
+		if node.Spec.ProviderID == "" {
+			continue
+		}
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-tokens }()
+			running, err := c.lb.serverRunning(ctx, node)
+			if err != nil {
+				klog.Warningf("failed to check server of node %s: %v", node.Name, err)
+				return
+			}
+			if !c.lb.servers.set(node.Name, running) {
+				return
+			}
+			if running {
+				klog.Infof("server of node %s is running again", node.Name)
+				c.nodeAvailable(node.Name)
+				return
+			}
+			klog.Infof("server of node %s is not running, failing over its ips in %s", node.Name, c.lb.servers.delay)
+			c.enqueueHeldBy(node.Name, c.lb.servers.delay)
+		}()
+	}
+	wg.Wait()
+}
+
+// failoverServices returns the Services of type LoadBalancer in failover-ip
+// mode.
+func (c *failoverController) failoverServices() []*v1.Service {
+	services, err := c.listers.services.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list services: %v", err)
+		return nil
+	}
+	var result []*v1.Service
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil {
+			continue
+		}
+		if mode, err := c.lb.mode(service); err == nil && mode == config.LoadBalancerModeFailoverIP {
+			result = append(result, service)
+		}
+	}
+	return result
+}
+
+func (c *failoverController) run() {
+	for {
+		key, shutdown := c.queue.Get()
+		if shutdown {
+			return
+		}
+		if err := c.reconcile(key); err != nil {
+			klog.Errorf("failed to reconcile failover ip of service %s: %v", key, err)
+			c.queue.AddRateLimited(key)
+		} else {
+			c.queue.Forget(key)
+		}
+		c.queue.Done(key)
+	}
+}
+
+// reconcile syncs the failover IP of the Service with the given key, once the
+// service controller provisioned it.
+func (c *failoverController) reconcile(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil
+	}
+	service, err := c.listers.services.Services(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil || len(service.Status.LoadBalancer.Ingress) == 0 {
+		return nil
+	}
+	mode, err := c.lb.mode(service)
+	if err != nil || mode != config.LoadBalancerModeFailoverIP || c.lb.activeMode(service) != mode {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	loadBalancerIP, err := c.lb.existingLoadBalancerIP(ctx, service)
+	if err != nil || loadBalancerIP == "" {
+		return err
+	}
+	nodes, err := c.listers.nodes.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	_, err = c.lb.syncLoadBalancer(ctx, loadBalancerIP, service, nodes)
+	if errors.Is(err, errNoLocalEndpoints) {
+		// The Service is enqueued again once its endpoints change.
+		klog.Infof("not placing ip of service %s: %v", key, err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package ionos
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+const (
+	defaultDeletionGracePeriod   = 5 * time.Minute
+	defaultDeletionConfirmations = 3
+)
+
+// deletionGuard tracks nodes whose servers are missing, so a node is only
+// reported as deleted after the server was confirmed missing repeatedly over
+// the grace period.
+type deletionGuard struct {
+	gracePeriod   time.Duration
+	confirmations int
+	now           func() time.Time
+
+	mu      sync.Mutex
+	missing map[string]*missingServer
+	// owners remembers the datacenter each node was last found in.
+	owners map[string]string
+}
+
+type missingServer struct {
+	since         time.Time
+	confirmations int
+}
+
+func newDeletionGuard(cfg config.DeletionConfig) *deletionGuard {
+	g := &deletionGuard{
+		gracePeriod:   cfg.GracePeriod.Duration,
+		confirmations: cfg.Confirmations,
+		now:           time.Now,
+		missing:       map[string]*missingServer{},
+		owners:        map[string]string{},
+	}
+	if g.gracePeriod <= 0 {
+		g.gracePeriod = defaultDeletionGracePeriod
+	}
+	if g.confirmations <= 0 {
+		g.confirmations = defaultDeletionConfirmations
+	}
+	return g
+}
+
+// found records that the server of node was found in datacenterID.
+func (g *deletionGuard) found(nodeName, datacenterID string) {
+	if nodeName == "" {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.missing, nodeName)
+	g.owners[nodeName] = datacenterID
+}
+
+// owner returns the datacenter the server of node was last found in.
+func (g *deletionGuard) owner(nodeName string) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	datacenterID, ok := g.owners[nodeName]
+	return datacenterID, ok
+}
+
+// confirmMissing records another check which found the server of node
+// missing and reports whether it has been missing long enough to be deleted.
+func (g *deletionGuard) confirmMissing(nodeName string) (bool, missingServer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	m, ok := g.missing[nodeName]
+	if !ok {
+		m = &missingServer{since: g.now()}
+		g.missing[nodeName] = m
+	}
+	m.confirmations++
+	confirmed := m.confirmations >= g.confirmations && g.now().Sub(m.since) >= g.gracePeriod
+	if confirmed {
+		delete(g.missing, nodeName)
+		delete(g.owners, nodeName)
+	}
+	return confirmed, *m
+}
+
+// reset forgets the missing checks of node, e.g. because a check could not be
+// completed.
+func (g *deletionGuard) reset(nodeName string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.missing, nodeName)
+}
@@ -0,0 +1,98 @@
+package ionos
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+const defaultDriftRepairInterval = 5 * time.Minute
+
+// repairDrift verifies that the failover IP of every placed Service is
+// attached to exactly one server, as IPs may be changed outside the provider.
+// Duplicates are removed right away, lost IPs and IPs held by another node
+// than recorded are synced again.
+func (c *failoverController) repairDrift() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.driftInterval)
+	defer cancel()
+	// An incomplete view would report IPs held in a failing datacenter as
+	// lost, so nothing is repaired unless all datacenters answer.
+	serversByIP := map[string][]client2.Server{}
+	for _, client := range c.lb.ionosClients {
+		found, err := client.ServersByIP(ctx)
+		if err != nil {
+			klog.Errorf("failed to list servers of datacenter %s to repair drift: %v", client.DatacenterId, err)
+			return
+		}
+		for ip, servers := range found {
+			serversByIP[ip] = append(serversByIP[ip], servers...)
+		}
+	}
+	nodes, err := c.listers.nodes.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list nodes to repair drift: %v", err)
+		return
+	}
+
+	for _, service := range c.failoverServices() {
+		if len(service.Status.LoadBalancer.Ingress) == 0 || c.lb.activeMode(service) != config.LoadBalancerModeFailoverIP {
+			continue
+		}
+		key := service.Namespace + "/" + service.Name
+		ip := service.Status.LoadBalancer.Ingress[0].IP
+		servers := serversByIP[ip]
+		switch len(servers) {
+		case 0:
+			klog.Warningf("ip %s of service %s is not attached to any server", ip, key)
+			c.lb.recorder.Eventf(service, v1.EventTypeWarning, "FailoverIPLost", "IP %s is not attached to any node, attaching it again", ip)
+			c.queue.Add(key)
+		case 1:
+			node := getNode(servers[0], nodes)
+			if node == nil || node.Name != service.Annotations[annotationLoadBalancerNode] || !c.lb.ready(node) {
+				klog.Warningf("ip %s of service %s is attached to server %s unexpectedly", ip, key, servers[0].ProviderID)
+				c.lb.recorder.Eventf(service, v1.EventTypeWarning, "FailoverIPDrifted",
+					"IP %s is attached to server %s, which is not the recorded or not an eligible node", ip, servers[0].Name)
+				c.queue.Add(key)
+			}
+		default:
+			c.removeDuplicates(ctx, service, ip, servers, nodes)
+			c.queue.Add(key)
+		}
+	}
+}
+
+// removeDuplicates removes ip from all but one of the servers holding it. The
+// recorded node of service is kept if it is ready, otherwise any ready node.
+func (c *failoverController) removeDuplicates(ctx context.Context, service *v1.Service, ip string, servers []client2.Server, nodes []*v1.Node) {
+	defer c.lb.locks.lock(service)()
+	keep := -1
+	for i, server := range servers {
+		node := getNode(server, nodes)
+		if node == nil || !IsLoadBalancerCandidate(node) {
+			continue
+		}
+		if keep < 0 || node.Name == service.Annotations[annotationLoadBalancerNode] {
+			keep = i
+		}
+	}
+	keep = max(keep, 0)
+
+	for i := range servers {
+		if servers[i].ProviderID == servers[keep].ProviderID {
+			continue
+		}
+		klog.Infof("removing duplicate ip %s of service %s/%s from server %s", ip, service.Namespace, service.Name, servers[i].ProviderID)
+		if err := c.lb.removeIPFromServer(ctx, ip, &servers[i]); err != nil {
+			klog.Errorf("failed to remove duplicate ip %s from server %s: %v", ip, servers[i].ProviderID, err)
+			continue
+		}
+		c.lb.recorder.Eventf(service, v1.EventTypeNormal, "DuplicateFailoverIPRemoved",
+			"Removed IP %s from server %s, as it is also attached to server %s", ip, servers[i].Name, servers[keep].Name)
+	}
+}
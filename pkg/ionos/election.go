@@ -0,0 +1,210 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// errNoLocalEndpoints is returned by the election of Services requiring
+// local endpoints if no candidate hosts one.
+var errNoLocalEndpoints = errors.New("no ready and healthy node hosts ready endpoints of the service")
+
+// electNode returns the node the failover IP of service has to be attached
+// to. The holder keeps the IP as long as it is a candidate, unless the IP
+// returns to its home node or moves to the preferred zone of service after
+// the minimum hold time.
+func (l loadbalancer) electNode(ctx context.Context, service *v1.Service, nodes []*v1.Node, holder *v1.Node) (*v1.Node, error) {
+	candidates, err := l.electionCandidates(ctx, service, nodes)
+	if errors.Is(err, errNoLocalEndpoints) && holder != nil {
+		klog.Infof("node %s keeps ip of service %s/%s, as no node hosts local endpoints", holder.Name, service.Namespace, service.Name)
+		return holder, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	preferred := preferredZoneNodes(service, candidates)
+
+	if holder != nil && slices.Contains(candidates, holder) {
+		key := service.Namespace + "/" + service.Name
+		switch {
+		case !l.hysteresis.holdExpired(key):
+			klog.Infof("node %s keeps ip of service %s for the minimum hold time", holder.Name, key)
+			return holder, nil
+		case slices.Contains(preferred, holder):
+			if home := l.stableHomeNode(service, preferred); home != nil && home != holder {
+				klog.Infof("returning ip of service %s to its home node %s", key, home.Name)
+				return home, nil
+			}
+			klog.Infof("node %s is valid loadbalancer node", holder.Name)
+			return holder, nil
+		}
+	}
+
+	zoned, err := l.zoneCandidates(ctx, service, nodes, preferred, holder)
+	if err != nil {
+		return nil, err
+	}
+	node, err := l.GetLoadBalancerNode(ctx, service, zoned)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, errors.New("no valid nodes found")
+	}
+	klog.Infof("node %s is elected as new loadbalancer node", node.Name)
+	return node, nil
+}
+
+// recordHomeNode records the node the failover IP of service was moved away
+// from as its home node, so the IP can return once the node is stable again.
+// The home node is cleared once the IP is back.
+func (l loadbalancer) recordHomeNode(ctx context.Context, service *v1.Service, holder, node *v1.Node) error {
+	home, ok := service.Annotations[annotationLoadBalancerHomeNode]
+	switch {
+	case l.hysteresis.returnAfter <= 0:
+		return nil
+	case ok && home == node.Name:
+		return l.clearAnnotation(ctx, service, annotationLoadBalancerHomeNode)
+	case !ok && holder != nil:
+		return l.recordAnnotation(ctx, service, annotationLoadBalancerHomeNode, holder.Name)
+	}
+	return nil
+}
+
+// electionCandidates returns the eligible, ready and healthy nodes the
+// failover IP of service may be held by. Services routing external traffic to local
+// endpoints only are limited to nodes hosting ready endpoints, falling back
+// to all nodes if none does and the policy is to prefer them. Otherwise
+// errNoLocalEndpoints is returned.
+func (l loadbalancer) electionCandidates(ctx context.Context, service *v1.Service, nodes []*v1.Node) ([]*v1.Node, error) {
+	eligible, err := l.eligibility(service)
+	if err != nil {
+		return nil, err
+	}
+	var ready []*v1.Node
+	for _, node := range nodes {
+		if l.ready(node) && eligible(node) && !l.servers.failed(node.Name) {
+			ready = append(ready, node)
+		}
+	}
+	if service.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyLocal {
+		return l.healthyNodes(ctx, service, ready, false), nil
+	}
+	policy, err := l.localEndpointsPolicy(service)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := l.localEndpointNodes(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	var local []*v1.Node
+	for _, node := range ready {
+		if endpoints.Has(node.Name) {
+			local = append(local, node)
+		}
+	}
+	key := service.Namespace + "/" + service.Name
+	if local = l.healthyNodes(ctx, service, local, true); len(local) > 0 {
+		l.noEndpoints.set(key, true)
+		return local, nil
+	}
+	if policy == config.LocalEndpointsRequire {
+		if l.noEndpoints.set(key, false) {
+			l.recorder.Eventf(service, v1.EventTypeWarning, "NoLocalEndpoints", "No ready and healthy node hosts ready endpoints of the Service")
+		}
+		return nil, errNoLocalEndpoints
+	}
+	return l.healthyNodes(ctx, service, ready, false), nil
+}
+
+// ready reports whether node is ready or became not ready less than the
+// not ready delay ago.
+func (l loadbalancer) ready(node *v1.Node) bool {
+	return IsLoadBalancerCandidate(node) || l.notReady.pending(node.Name)
+}
+
+// eligibility returns a predicate for the nodes which may hold the failover IP
+// of service. Nodes cordoned for at least the cordon delay, nodes excluded
+// from external load balancers and nodes not matching the node selectors of
+// the cloud config and service are not eligible.
+func (l loadbalancer) eligibility(service *v1.Service) (func(*v1.Node) bool, error) {
+	global, err := labels.Parse(l.config.NodeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid loadBalancer.nodeSelector: %w", err)
+	}
+	perService, err := labels.Parse(service.Annotations[annotationNodeSelector])
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotation %s: %w", annotationNodeSelector, err)
+	}
+	return func(node *v1.Node) bool {
+		if node.Spec.Unschedulable && !l.cordoned.pending(node.Name) {
+			return false
+		}
+		if _, ok := node.Labels[v1.LabelNodeExcludeBalancers]; ok {
+			return false
+		}
+		return global.Matches(labels.Set(node.Labels)) && perService.Matches(labels.Set(node.Labels))
+	}, nil
+}
+
+func (l loadbalancer) localEndpointsPolicy(service *v1.Service) (string, error) {
+	policy, ok := service.Annotations[annotationLocalEndpoints]
+	if !ok {
+		policy = l.config.LocalEndpoints
+	}
+	switch policy {
+	case "", config.LocalEndpointsPrefer:
+		return config.LocalEndpointsPrefer, nil
+	case config.LocalEndpointsRequire:
+		return policy, nil
+	}
+	return "", fmt.Errorf("annotation %s must be %s or %s, got %q", annotationLocalEndpoints,
+		config.LocalEndpointsPrefer, config.LocalEndpointsRequire, policy)
+}
+
+// localEndpointNodes returns the names of the nodes hosting ready endpoints of
+// service, read from the informer cache once it is synced.
+func (l loadbalancer) localEndpointNodes(ctx context.Context, service *v1.Service) (sets.Set[string], error) {
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service.Name})
+	var endpointSlices []*discoveryv1.EndpointSlice
+	if cached := l.listers.Load(); cached != nil {
+		var err error
+		if endpointSlices, err = cached.endpointSlices.EndpointSlices(service.Namespace).List(selector); err != nil {
+			return nil, err
+		}
+	} else {
+		if l.kubeClient.Interface == nil {
+			return nil, errors.New("endpoint slices are not available before the cloud provider is initialized")
+		}
+		list, err := l.kubeClient.DiscoveryV1().EndpointSlices(service.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list endpoint slices of service %s/%s: %w", service.Namespace, service.Name, err)
+		}
+		for i := range list.Items {
+			endpointSlices = append(endpointSlices, &list.Items[i])
+		}
+	}
+
+	nodes := sets.New[string]()
+	for _, slice := range endpointSlices {
+		for _, endpoint := range slice.Endpoints {
+			// A missing ready condition has to be interpreted as ready.
+			if endpoint.NodeName != nil && (endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready) {
+				nodes.Insert(*endpoint.NodeName)
+			}
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,34 @@
+package ionos
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// recorder emits Kubernetes events. It is shared by value copies of the
+// provider and only starts recording once Initialize provided a client.
+type recorder struct {
+	record.EventRecorder
+}
+
+func (r *recorder) start(k8sClient kubernetes.Interface) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartStructuredLogging(4)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	r.EventRecorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: config.ClientName})
+}
+
+func (r *recorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...any) {
+	if r == nil || r.EventRecorder == nil {
+		klog.Infof("event %s/%s not recorded, recorder not initialized: "+messageFmt, append([]any{eventType, reason}, args...)...)
+		return
+	}
+	r.EventRecorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
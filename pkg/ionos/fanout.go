@@ -0,0 +1,120 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+)
+
+const defaultDiscoveryParallelism = 4
+
+// fanOutResult is the first result found by fanOut together with the client
+// which found it.
+type fanOutResult[T any] struct {
+	value  *T
+	client *client2.IONOSClient
+}
+
+// fanOut calls fn for all clients concurrently with at most parallelism calls
+// in flight. The first non-nil result wins and cancels all outstanding calls.
+// Errors of the other clients are only returned if no client found a result,
+// so a failing datacenter does not hide a server found in another one.
+func fanOut[T any](
+	ctx context.Context,
+	clients []*client2.IONOSClient,
+	parallelism int,
+	fn func(context.Context, *client2.IONOSClient) (*T, error),
+) (*T, *client2.IONOSClient, error) {
+	if parallelism <= 0 {
+		parallelism = defaultDiscoveryParallelism
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		found  *fanOutResult[T]
+		errs   []error
+		tokens = make(chan struct{}, parallelism)
+	)
+	for _, client := range clients {
+		select {
+		case tokens <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(client *client2.IONOSClient) {
+			defer wg.Done()
+			defer func() { <-tokens }()
+			value, err := fn(ctx, client)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case found != nil:
+				// a result has already been found, everything else is noise of cancelled calls
+			case err != nil:
+				errs = append(errs, fmt.Errorf("datacenter %s: %w", client.DatacenterId, err))
+			case value != nil:
+				found = &fanOutResult[T]{value: value, client: client}
+				cancel()
+			}
+		}(client)
+	}
+	wg.Wait()
+
+	if found != nil {
+		return found.value, found.client, nil
+	}
+	if err := context.Cause(ctx); err != nil && len(errs) == 0 {
+		return nil, nil, err
+	}
+	return nil, nil, errors.Join(errs...)
+}
+
+// fanOutAll calls fn for all clients concurrently with at most parallelism
+// calls in flight and collects the results of all clients. The errors of
+// failing clients are joined and returned alongside the collected results.
+func fanOutAll[T any](
+	ctx context.Context,
+	clients []*client2.IONOSClient,
+	parallelism int,
+	fn func(context.Context, *client2.IONOSClient) ([]T, error),
+) ([]T, error) {
+	if parallelism <= 0 {
+		parallelism = defaultDiscoveryParallelism
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []T
+		errs    []error
+		tokens  = make(chan struct{}, parallelism)
+	)
+	for _, client := range clients {
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func(client *client2.IONOSClient) {
+			defer wg.Done()
+			defer func() { <-tokens }()
+			values, err := fn(ctx, client)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("datacenter %s: %w", client.DatacenterId, err))
+				return
+			}
+			results = append(results, values...)
+		}(client)
+	}
+	wg.Wait()
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package ionos
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultGarbageCollectionInterval    = 10 * time.Minute
+	defaultGarbageCollectionGracePeriod = 30 * time.Minute
+)
+
+// collectOrphanedIPs removes the failover IPs the provider attached to
+// servers which no Service owns anymore, e.g. because the Service was
+// deleted while the provider was down. IPs are only removed once they were
+// orphaned for the grace period, and never if they are an address of a node.
+func (c *failoverController) collectOrphanedIPs() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.gcInterval)
+	defer cancel()
+	entries, err := c.lb.ledger.entries(ctx)
+	if err != nil {
+		klog.Errorf("failed to collect orphaned ips: %v", err)
+		return
+	}
+	services, err := c.listers.services.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to collect orphaned ips: %v", err)
+		return
+	}
+	nodes, err := c.listers.nodes.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to collect orphaned ips: %v", err)
+		return
+	}
+
+	owned := sets.New[string]()
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		if service.Spec.LoadBalancerIP != "" {
+			owned.Insert(service.Spec.LoadBalancerIP)
+		}
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			owned.Insert(ingress.IP)
+		}
+	}
+	nodeAddresses := sets.New[string]()
+	nodesByServer := map[string]*v1.Node{}
+	for _, node := range nodes {
+		for _, address := range node.Status.Addresses {
+			nodeAddresses.Insert(address.Address)
+		}
+		if providerID, err := providerIDFromNode(node); err == nil {
+			nodesByServer[providerID.ServerID] = node
+		}
+	}
+
+	now := time.Now()
+	for ip := range c.orphanedSince {
+		if _, ok := entries[ip]; !ok || owned.Has(ip) {
+			delete(c.orphanedSince, ip)
+		}
+	}
+	for ip, servers := range entries {
+		if owned.Has(ip) {
+			continue
+		}
+		since, ok := c.orphanedSince[ip]
+		if !ok {
+			since = now
+			c.orphanedSince[ip] = since
+		}
+		if now.Sub(since) < c.gcGracePeriod {
+			klog.V(2).Infof("ip %s is orphaned since %s, waiting for the grace period", ip, since.Format(time.RFC3339))
+			continue
+		}
+		if nodeAddresses.Has(ip) {
+			klog.Warningf("orphaned ip %s is an address of a node, not removing it", ip)
+			continue
+		}
+		for _, server := range servers {
+			datacenterID, serverID, _ := strings.Cut(server, "/")
+			node := nodesByServer[serverID]
+			if c.gcDryRun {
+				klog.Infof("dry run: would remove orphaned ip %s from server %s", ip, server)
+				if node != nil {
+					c.lb.recorder.Eventf(node, v1.EventTypeNormal, "OrphanedIPFound", "Orphaned IP %s would be removed (dry run)", ip)
+				}
+				continue
+			}
+			client, ok := c.lb.ionosClients[datacenterID]
+			if !ok {
+				klog.Warningf("no client configured for datacenter %s, cannot remove orphaned ip %s", datacenterID, ip)
+				continue
+			}
+			klog.Infof("removing orphaned ip %s from server %s", ip, server)
+			if err := client.RemoveIPFromNode(ctx, ip, serverID); err != nil {
+				klog.Errorf("failed to remove orphaned ip %s from server %s: %v", ip, server, err)
+				continue
+			}
+			if err := c.lb.ledger.forget(ctx, ip, datacenterID, serverID); err != nil {
+				klog.Errorf("failed to forget orphaned ip %s: %v", ip, err)
+			}
+			if node != nil {
+				c.lb.recorder.Eventf(node, v1.EventTypeNormal, "OrphanedIPRemoved", "Removed orphaned IP %s", ip)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+const (
+	defaultHealthCheckPort             = 10256
+	defaultHealthCheckTimeout          = 2 * time.Second
+	defaultHealthCheckFailureThreshold = 2
+	defaultHealthCheckSuccessThreshold = 2
+	healthCheckParallelism             = 8
+)
+
+// healthProber actively probes nodes before they are elected for or keep a
+// failover IP, as the NodeReady condition lags behind a node losing its
+// network by up to the node monitor grace period.
+type healthProber struct {
+	enabled          bool
+	port             int32
+	failureThreshold int
+	successThreshold int
+	client           *http.Client
+
+	mu      sync.Mutex
+	results map[string]*probeResults
+}
+
+// probeResults are the consecutive results of probing a node on a port.
+type probeResults struct {
+	healthy   bool
+	failures  int
+	successes int
+}
+
+func newHealthProber(cfg config.HealthCheckConfig) *healthProber {
+	p := &healthProber{
+		enabled:          cfg.Enabled,
+		port:             cfg.Port,
+		failureThreshold: cfg.FailureThreshold,
+		successThreshold: cfg.SuccessThreshold,
+		results:          map[string]*probeResults{},
+	}
+	if p.port <= 0 {
+		p.port = defaultHealthCheckPort
+	}
+	if p.failureThreshold <= 0 {
+		p.failureThreshold = defaultHealthCheckFailureThreshold
+	}
+	if p.successThreshold <= 0 {
+		p.successThreshold = defaultHealthCheckSuccessThreshold
+	}
+	timeout := cfg.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	p.client = &http.Client{Timeout: timeout}
+	return p
+}
+
+// record records the result of a probe and reports whether the node is
+// healthy. A node changes its health only after the threshold of consecutive
+// results was reached, a node probed for the first time takes the result.
+func (p *healthProber) record(key string, ok bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	results, known := p.results[key]
+	if !known {
+		p.results[key] = &probeResults{healthy: ok}
+		return ok
+	}
+	if ok {
+		results.failures = 0
+		results.successes++
+		if results.successes >= p.successThreshold {
+			results.healthy = true
+		}
+	} else {
+		results.successes = 0
+		results.failures++
+		if results.failures >= p.failureThreshold {
+			results.healthy = false
+		}
+	}
+	return results.healthy
+}
+
+// probeHTTP requests /healthz on the given address and fails unless it
+// responds with 200.
+func (p *healthProber) probeHTTP(ctx context.Context, ip string, port int32) error {
+	url := "http://" + net.JoinHostPort(ip, strconv.Itoa(int(port))) + "/healthz"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", url, resp.Status)
+	}
+	return nil
+}
+
+// healthyNodes returns the nodes passing the health probe. Nodes are probed on
+// the health check node port of service if serviceHealth is set, otherwise on
+// the kube-proxy healthz port.
+func (l loadbalancer) healthyNodes(ctx context.Context, service *v1.Service, nodes []*v1.Node, serviceHealth bool) []*v1.Node {
+	if !l.health.enabled {
+		return nodes
+	}
+	port := l.health.port
+	if serviceHealth && service.Spec.HealthCheckNodePort != 0 {
+		port = service.Spec.HealthCheckNodePort
+	}
+
+	var (
+		wg      sync.WaitGroup
+		healthy = make([]bool, len(nodes))
+		tokens  = make(chan struct{}, healthCheckParallelism)
+	)
+	for i, node := range nodes {
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-tokens }()
+			err := l.probeNode(ctx, node, port)
+			if err != nil {
+				klog.V(2).Infof("health probe of node %s on port %d failed: %v", node.Name, port, err)
+			}
+			healthy[i] = l.health.record(node.Name+"/"+strconv.Itoa(int(port)), err == nil)
+		}()
+	}
+	wg.Wait()
+
+	var result []*v1.Node
+	for i, node := range nodes {
+		if healthy[i] {
+			result = append(result, node)
+		} else {
+			klog.Infof("node %s is not healthy, skipping it as load balancer node", node.Name)
+		}
+	}
+	return result
+}
+
+// probeNode probes port on the internal IP of node and checks that the
+// failover controller did not find the VM of the node not running. The VM
+// states are polled by the failover controller rather than by every probe.
+func (l loadbalancer) probeNode(ctx context.Context, node *v1.Node, port int32) error {
+	ips := nodeInternalIPs(node)
+	if len(ips) == 0 {
+		return errors.New("node has no internal IP")
+	}
+	if err := l.health.probeHTTP(ctx, ips[0], port); err != nil {
+		return err
+	}
+	if l.servers.failing(node.Name) {
+		return errors.New("server is not running")
+	}
+	return nil
+}
+
+// serverRunning reports whether IONOS reports the VM of the server of node as
+// running. A missing server is not running.
+func (l loadbalancer) serverRunning(ctx context.Context, node *v1.Node) (bool, error) {
+	providerID, err := providerIDFromNode(node)
+	if err != nil {
+		return false, err
+	}
+	clients, err := clientsFor(l.ionosClients, providerID)
+	if err != nil {
+		return false, err
+	}
+	state, _, err := fanOut(ctx, clients, 0, func(ctx context.Context, client *client2.IONOSClient) (*client2.ServerState, error) {
+		return client.GetServerState(ctx, providerID.ServerID)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get state of server %s: %w", providerID, err)
+	}
+	return state != nil && runningVMStates.Has(state.VMState), nil
+}
@@ -0,0 +1,127 @@
+package ionos
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+const defaultMoveWindow = 10 * time.Minute
+
+// hysteresis keeps failover IPs from bouncing between nodes whose state
+// oscillates. IPs are held by a node for a minimum time before they move
+// voluntarily, and moves are rate limited per Service and per cluster.
+type hysteresis struct {
+	minHoldTime     time.Duration
+	returnAfter     time.Duration
+	window          time.Duration
+	maxServiceMoves int
+	maxClusterMoves int
+	now             func() time.Time
+
+	mu           sync.Mutex
+	heldSince    map[string]time.Time
+	serviceMoves map[string][]time.Time
+	clusterMoves []time.Time
+}
+
+func newHysteresis(cfg config.FailoverConfig) *hysteresis {
+	h := &hysteresis{
+		minHoldTime:     max(cfg.MinHoldTime.Duration, 0),
+		returnAfter:     max(cfg.ReturnAfter.Duration, 0),
+		window:          cfg.MoveWindow.Duration,
+		maxServiceMoves: cfg.MaxMovesPerService,
+		maxClusterMoves: cfg.MaxMovesPerCluster,
+		now:             time.Now,
+		heldSince:       map[string]time.Time{},
+		serviceMoves:    map[string][]time.Time{},
+	}
+	if h.window <= 0 {
+		h.window = defaultMoveWindow
+	}
+	return h
+}
+
+// holdExpired reports whether the IP of the Service with the given key was
+// held for the minimum hold time. IPs whose placement was not observed since
+// the start of the controller are considered placed now.
+func (h *hysteresis) holdExpired(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	since, ok := h.heldSince[key]
+	if !ok {
+		since = h.now()
+		h.heldSince[key] = since
+	}
+	return h.now().Sub(since) >= h.minHoldTime
+}
+
+// placed records that the IP of the Service with the given key was attached
+// to a new node.
+func (h *hysteresis) placed(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heldSince[key] = h.now()
+}
+
+// checkMove returns how long to wait if moving the IP of the Service with the
+// given key exceeds a rate limit.
+func (h *hysteresis) checkMove(key string) (time.Duration, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	h.clusterMoves = h.prune(h.clusterMoves, now)
+	moves := h.prune(h.serviceMoves[key], now)
+	h.serviceMoves[key] = moves
+	if h.maxServiceMoves > 0 && len(moves) >= h.maxServiceMoves {
+		return moves[0].Add(h.window).Sub(now), fmt.Errorf("ip moved %d times within %s", len(moves), h.window)
+	}
+	if h.maxClusterMoves > 0 && len(h.clusterMoves) >= h.maxClusterMoves {
+		return h.clusterMoves[0].Add(h.window).Sub(now), fmt.Errorf("ips of the cluster moved %d times within %s",
+			len(h.clusterMoves), h.window)
+	}
+	return 0, nil
+}
+
+// recordMove records that the IP of the Service with the given key moved.
+// Only moves which succeeded count against the rate limits.
+func (h *hysteresis) recordMove(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	h.serviceMoves[key] = append(h.serviceMoves[key], now)
+	h.clusterMoves = append(h.clusterMoves, now)
+}
+
+// prune drops the moves which left the window.
+func (h *hysteresis) prune(moves []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(moves) && now.Sub(moves[i]) >= h.window {
+		i++
+	}
+	return moves[i:]
+}
+
+// stableHomeNode returns the node the IP of service was failed over from, if
+// it is a candidate again and has been ready for the return period.
+func (l loadbalancer) stableHomeNode(service *v1.Service, candidates []*v1.Node) *v1.Node {
+	home, ok := service.Annotations[annotationLoadBalancerHomeNode]
+	if !ok || l.hysteresis.returnAfter <= 0 {
+		return nil
+	}
+	for _, node := range candidates {
+		if node.Name != home {
+			continue
+		}
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady && l.hysteresis.now().Sub(condition.LastTransitionTime.Time) >= l.hysteresis.returnAfter {
+				return node
+			}
+		}
+	}
+	return nil
+}
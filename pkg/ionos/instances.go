@@ -1,32 +1,27 @@
 package ionos
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
 	"k8s.io/klog/v2"
 
 	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
-	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
 )
 
 var _ cloudprovider.InstancesV2 = &instances{}
 
-func GetUUIDFromNode(node *v1.Node) string {
-	if node == nil {
-		return ""
-	}
-	withoutPrefix := strings.TrimPrefix(node.Spec.ProviderID, config.ProviderPrefix)
-	return strings.ToLower(strings.TrimSpace(withoutPrefix))
-}
-
 func (i instances) AddClient(datacenterId string, token []byte) error {
 	if i.ionosClients[datacenterId] == nil {
-		c, err := client2.New(datacenterId, token)
+		c, err := client2.New(datacenterId, token, i.clientOptions)
 		if err != nil {
 			return err
 		}
@@ -36,62 +31,232 @@ func (i instances) AddClient(datacenterId string, token []byte) error {
 }
 
 // no caching
-func (i instances) discoverNode(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
-	providerID := GetUUIDFromNode(node)
-	for _, client := range i.ionosClients {
-		var err error
-		var server *cloudprovider.InstanceMetadata
-		klog.Infof("discoverNode (datacenterId %s) %s %s", client.DatacenterId, node.Name, providerID)
-		if providerID != "" {
-			server, err = client.GetServer(ctx, providerID)
-		} else {
-			server, err = client.GetServerByName(ctx, node.Name)
+func (i instances) discoverNode(ctx context.Context, node *v1.Node) (*client2.Instance, error) {
+	providerID, err := providerIDFromNode(node)
+	if err != nil {
+		return nil, err
+	}
+	if providerID.ServerID == "" {
+		return i.discoverNodeWithoutProviderID(ctx, node)
+	}
+	clients, err := clientsFor(i.ionosClients, providerID)
+	if err != nil {
+		return nil, err
+	}
+	server, _, err := fanOut(ctx, clients, i.parallelism, func(ctx context.Context, client *client2.IONOSClient) (*client2.Instance, error) {
+		klog.Infof("discoverNode (datacenterId %s) %s %s", client.DatacenterId, node.Name, providerID.ServerID)
+		return client.GetServer(ctx, providerID.ServerID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to discoverNode %w", err)
+	}
+	if server == nil {
+		return nil, nil
+	}
+	if providerID.DatacenterID == "" && i.clientOptions.QualifiedProviderID {
+		klog.V(2).Infof("node %s still uses legacy provider ID %s, re-register it to migrate to %s", node.Name, node.Spec.ProviderID, server.Metadata.ProviderID)
+	}
+	i.deletionGuard.found(node.Name, server.DatacenterID)
+	server.Metadata.Zone = resolveZone(i.zoneConfig, server.DatacenterID, server.Metadata.Zone)
+	return server, nil
+}
+
+// discoverNodeWithoutProviderID looks up a node by its name, its normalized
+// name and finally its internal IPs in all datacenters. The most confident
+// kind of match wins, but only if it is unambiguous.
+func (i instances) discoverNodeWithoutProviderID(ctx context.Context, node *v1.Node) (*client2.Instance, error) {
+	clients, err := clientsFor(i.ionosClients, client2.ProviderID{})
+	if err != nil {
+		return nil, err
+	}
+	internalIPs := nodeInternalIPs(node)
+	matches, err := fanOutAll(ctx, clients, i.parallelism, func(ctx context.Context, client *client2.IONOSClient) ([]client2.ServerMatch, error) {
+		klog.Infof("discoverNode (datacenterId %s) %s", client.DatacenterId, node.Name)
+		return client.FindServers(ctx, node.Name, internalIPs)
+	})
+	if err != nil {
+		// A failing datacenter may hold a better or a competing match.
+		return nil, fmt.Errorf("failed to discoverNode %w", err)
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	best := slices.MinFunc(matches, func(a, b client2.ServerMatch) int { return cmp.Compare(a.Kind, b.Kind) })
+	var candidates []string
+	for _, match := range matches {
+		if match.Kind == best.Kind {
+			candidates = append(candidates, fmt.Sprintf("%s (%s)", match.Name, match.Instance.Metadata.ProviderID))
 		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to discoverNode %v", err)
+	}
+	if len(candidates) > 1 {
+		return nil, fmt.Errorf("node %s matches %d servers by %s, refusing to guess: %s",
+			node.Name, len(candidates), best.Kind, strings.Join(candidates, ", "))
+	}
+	klog.Infof("discoverNode %s matched server %s by %s", node.Name, best.Name, best.Kind)
+	server := best.Instance
+	i.deletionGuard.found(node.Name, server.DatacenterID)
+	server.Metadata.Zone = resolveZone(i.zoneConfig, server.DatacenterID, server.Metadata.Zone)
+	return server, nil
+}
+
+// nodeInternalIPs returns the internal IPs reported by the node and the IPs
+// passed to the kubelet with --node-ip, which are known before the node is
+// initialized.
+func nodeInternalIPs(node *v1.Node) []string {
+	var ips []string
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP {
+			ips = append(ips, address.Address)
 		}
-		if server == nil {
-			continue
+	}
+	if provided, ok := node.Annotations[cloudproviderapi.AnnotationAlphaProvidedIPAddr]; ok {
+		for _, ip := range strings.Split(provided, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" && !slices.Contains(ips, ip) {
+				ips = append(ips, ip)
+			}
 		}
-		return server, nil
 	}
-	return nil, nil
+	return ips
 }
 
 func (i instances) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
 	klog.Infof("InstanceExists %s", node.Name)
 	server, err := i.discoverNode(ctx, node)
 	klog.InfoDepth(1, server)
-	return server != nil, err
+	if err != nil {
+		i.deletionGuard.reset(node.Name)
+		return false, err
+	}
+	if server == nil {
+		return i.confirmDeleted(ctx, node)
+	}
+	if len(i.lifecycle.deletedStates) == 0 {
+		return true, nil
+	}
+	state, err := i.serverState(ctx, client2.ProviderID{DatacenterID: server.DatacenterID, ServerID: server.ServerID})
+	if err != nil {
+		return false, err
+	}
+	if state != nil && i.lifecycle.isDeleted(*state) {
+		klog.Infof("server of node %s is in state %s, reporting it as deleted", node.Name, state.State)
+		return false, nil
+	}
+	return true, nil
+}
+
+// confirmDeleted decides whether a node whose server was not found is
+// reported as deleted. Deletion is withheld until the server was confirmed
+// missing over the grace period, while any datacenter fails and while its
+// datacenter does not answer with an explicit not found, as a transient API
+// problem must not delete healthy nodes. The datacenter is taken from a
+// qualified provider ID, else from where the server was last seen; otherwise
+// every datacenter is asked.
+func (i instances) confirmDeleted(ctx context.Context, node *v1.Node) (bool, error) {
+	providerID, err := providerIDFromNode(node)
+	if err != nil {
+		return true, err
+	}
+	if providerID.DatacenterID == "" {
+		providerID.DatacenterID, _ = i.deletionGuard.owner(node.Name)
+	}
+	if providerID.DatacenterID != "" && i.ionosClients[providerID.DatacenterID] == nil {
+		i.recorder.Eventf(node, v1.EventTypeWarning, "DeletionWithheld",
+			"Server not found, but datacenter %s it belongs to is no longer configured", providerID.DatacenterID)
+		return true, nil
+	}
+	if err := i.checkMissing(ctx, providerID); err != nil {
+		i.deletionGuard.reset(node.Name)
+		i.recorder.Eventf(node, v1.EventTypeWarning, "DeletionWithheld", "Server not found, but its absence is not confirmed: %v", err)
+		return true, nil
+	}
+	confirmed, missing := i.deletionGuard.confirmMissing(node.Name)
+	if !confirmed {
+		i.recorder.Eventf(node, v1.EventTypeWarning, "DeletionWithheld",
+			"Server not found since %s (%d checks), waiting for the grace period of %s and %d checks",
+			missing.since.Format(time.RFC3339), missing.confirmations, i.deletionGuard.gracePeriod, i.deletionGuard.confirmations)
+		return true, nil
+	}
+	klog.Infof("server of node %s confirmed missing since %s, reporting it as deleted", node.Name, missing.since)
+	return false, nil
+}
+
+// checkMissing returns an error while any datacenter fails and unless every
+// datacenter which may own the server behind providerID reports it as not
+// found. Without a server ID the datacenters only have to be reachable.
+func (i instances) checkMissing(ctx context.Context, providerID client2.ProviderID) error {
+	owners, err := clientsFor(i.ionosClients, providerID)
+	if err != nil {
+		return err
+	}
+	clients, err := clientsFor(i.ionosClients, client2.ProviderID{})
+	if err != nil {
+		return err
+	}
+	found, err := fanOutAll(ctx, clients, i.parallelism, func(ctx context.Context, client *client2.IONOSClient) ([]string, error) {
+		if providerID.ServerID == "" || !slices.Contains(owners, client) {
+			return nil, client.Ping(ctx)
+		}
+		state, err := client.GetServerState(ctx, providerID.ServerID)
+		if err != nil || state == nil {
+			return nil, err
+		}
+		return []string{client.DatacenterId}, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("server %s exists in datacenter %s", providerID.ServerID, found[0])
+	}
+	return nil
 }
 
 func (i instances) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
 	klog.Infof("InstanceShutdown %s", node.Name)
-	providerID := GetUUIDFromNode(node)
-	if providerID == "" {
+	providerID, err := providerIDFromNode(node)
+	if err != nil {
+		return false, err
+	}
+	if providerID.ServerID == "" {
 		return false, nil
 	}
-	for _, client := range i.ionosClients {
-		serverState, err := client.GetServerState(ctx, providerID)
-		if err != nil {
-			continue
-		}
-		if serverState == "" {
-			continue
-		}
-		if serverState != "RUNNING" && serverState != "NOSTATE" && serverState != "BLOCKED" {
-			return true, nil
-		}
+	state, err := i.serverState(ctx, providerID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get state of server %s: %w", providerID, err)
 	}
-	return false, nil
+	if state == nil {
+		return false, nil
+	}
+	klog.V(4).Infof("server of node %s has vm state %s, state %s and type %s", node.Name, state.VMState, state.State, state.Type)
+	return i.lifecycle.isShutdown(*state), nil
+}
+
+// serverState returns the state of the server behind providerID or nil if no
+// datacenter knows the server.
+func (i instances) serverState(ctx context.Context, providerID client2.ProviderID) (*client2.ServerState, error) {
+	clients, err := clientsFor(i.ionosClients, providerID)
+	if err != nil {
+		return nil, err
+	}
+	state, _, err := fanOut(ctx, clients, i.parallelism, func(ctx context.Context, client *client2.IONOSClient) (*client2.ServerState, error) {
+		return client.GetServerState(ctx, providerID.ServerID)
+	})
+	return state, err
 }
 
 func (i instances) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
 	klog.Infof("InstanceMetadata %s", node.Name)
 	server, err := i.discoverNode(ctx, node)
-	if server == nil && err == nil {
+	if err != nil {
+		return nil, err
+	}
+	if server == nil {
 		return nil, errors.New("failed to discoverNode")
 	}
-	klog.InfoDepth(1, server)
-	return server, err
+	klog.InfoDepth(1, server.Metadata)
+	if !server.NICsIncomplete {
+		i.syncNICAnnotation(ctx, node, server.NICs)
+	}
+	return server.Metadata, nil
 }
@@ -0,0 +1,155 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// Labels of the IP blocks reserved for Services.
+const (
+	labelCluster          = "k8s-cluster"
+	labelServiceUID       = "k8s-service-uid"
+	labelServiceNamespace = "k8s-service-namespace"
+	labelServiceName      = "k8s-service-name"
+)
+
+// loadBalancerIP returns spec.loadBalancerIP of service, the IP allocated
+// from the IP pool it is annotated with or the IP of the IP block reserved for
+// service, in this order. The block is reserved in the location of the
+// datacenter the load balancer of mode lives in.
+func (l loadbalancer) loadBalancerIP(ctx context.Context, clusterName, mode string, service *v1.Service) (string, error) {
+	pool := service.Annotations[annotationIPPool]
+	if service.Spec.LoadBalancerIP != "" {
+		pool = ""
+	}
+	if err := l.releasePoolIPs(ctx, service, pool); err != nil {
+		klog.Warningf("failed to release stale ip pool allocations of service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+	if service.Spec.LoadBalancerIP != "" {
+		return service.Spec.LoadBalancerIP, nil
+	}
+	if pool != "" {
+		return l.allocatePoolIP(ctx, pool, service)
+	}
+	client, err := datacenterClient(l.ionosClients, l.ipBlockDatacenter(mode))
+	if err != nil {
+		return "", err
+	}
+	block, err := client.FindIPBlock(ctx, labelServiceUID, string(service.UID))
+	if err != nil {
+		return "", err
+	}
+	if block == nil {
+		block, err = client.ReserveIPBlock(ctx, fmt.Sprintf("%s-%s", service.Namespace, service.Name), map[string]string{
+			labelCluster:          l.clusterID(clusterName),
+			labelServiceUID:       string(service.UID),
+			labelServiceNamespace: service.Namespace,
+			labelServiceName:      service.Name,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to reserve ip block: %w", err)
+		}
+		l.recorder.Eventf(service, v1.EventTypeNormal, "IPBlockReserved", "Reserved IP block %s in %s", block.ID, block.Location)
+	}
+	if !block.Ready() {
+		return "", cloudproviderapi.NewRetryError(fmt.Sprintf("ip block %s is %s", block.ID, block.State), provisioningRetryDelay)
+	}
+	return block.IPs[0], nil
+}
+
+// existingLoadBalancerIP is like loadBalancerIP, but returns an empty IP
+// instead of reserving an IP block.
+func (l loadbalancer) existingLoadBalancerIP(ctx context.Context, service *v1.Service) (string, error) {
+	if service.Spec.LoadBalancerIP != "" {
+		return service.Spec.LoadBalancerIP, nil
+	}
+	if pool := service.Annotations[annotationIPPool]; pool != "" {
+		return l.existingPoolIP(ctx, pool, service)
+	}
+	client, err := contractClient(l.ionosClients)
+	if err != nil {
+		return "", err
+	}
+	block, err := client.FindIPBlock(ctx, labelServiceUID, string(service.UID))
+	if err != nil || block == nil || !block.Ready() {
+		return "", err
+	}
+	return block.IPs[0], nil
+}
+
+// releaseIP releases the IP allocated to service from its IP pool and the IP
+// block reserved for service unless the Service asks to retain it. The block
+// is looked up even if spec.loadBalancerIP is set, as it may have been
+// reserved before.
+func (l loadbalancer) releaseIP(ctx context.Context, service *v1.Service) error {
+	if err := l.releasePoolIPs(ctx, service, ""); err != nil {
+		if _, ok := service.Annotations[annotationIPPool]; ok {
+			return err
+		}
+		klog.Warningf("failed to release ip pool allocations of service %s/%s: %v", service.Namespace, service.Name, err)
+	}
+	if value, ok := service.Annotations[annotationRetainIP]; ok {
+		retain, err := strconv.ParseBool(value)
+		if err != nil {
+			klog.Warningf("service %s/%s has an invalid %s annotation %q, retaining its ip block", service.Namespace, service.Name, annotationRetainIP, value)
+		}
+		if retain || err != nil {
+			return nil
+		}
+	}
+	client, err := contractClient(l.ionosClients)
+	if err != nil {
+		return err
+	}
+	block, err := client.FindIPBlock(ctx, labelServiceUID, string(service.UID))
+	if err != nil || block == nil {
+		return err
+	}
+	if err := client.ReleaseIPBlock(ctx, block.ID); err != nil {
+		return fmt.Errorf("failed to release ip block %s: %w", block.ID, err)
+	}
+	l.recorder.Eventf(service, v1.EventTypeNormal, "IPBlockReleased", "Released IP block %s", block.ID)
+	return nil
+}
+
+// ipBlockDatacenter returns the datacenter in whose location IP blocks for
+// load balancers of mode are reserved.
+func (l loadbalancer) ipBlockDatacenter(mode string) string {
+	switch mode {
+	case config.LoadBalancerModeNLB:
+		return l.config.NLB.DatacenterID
+	case config.LoadBalancerModeALB:
+		return l.config.ALB.DatacenterID
+	default:
+		return l.config.DatacenterID
+	}
+}
+
+// contractClient returns a client for the APIs which are not bound to a
+// datacenter, like IP blocks and labels, which any client can call.
+func contractClient(ionosClients map[string]*client2.IONOSClient) (*client2.IONOSClient, error) {
+	ids := slices.Sorted(maps.Keys(ionosClients))
+	if len(ids) == 0 {
+		return nil, errors.New("no datacenter configured")
+	}
+	return ionosClients[ids[0]], nil
+}
+
+// clusterID returns the ID IONOS resources of the cluster are labeled with.
+func (l loadbalancer) clusterID(clusterName string) string {
+	if l.clientOptions.ClusterID != "" {
+		return l.clientOptions.ClusterID
+	}
+	return clusterName
+}
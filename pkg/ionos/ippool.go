@@ -0,0 +1,244 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// ipPoolResource is the cluster scoped IPPool custom resource, see
+// manifests/ippool-crd.yaml.
+var ipPoolResource = schema.GroupVersionResource{Group: "ionos.cloud", Version: "v1alpha1", Resource: "ippools"}
+
+// ipPool hands out the IPs of IONOS IP blocks to Services.
+type ipPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ipPoolSpec   `json:"spec"`
+	Status ipPoolStatus `json:"status,omitempty"`
+}
+
+type ipPoolSpec struct {
+	// IPBlockIDs are the IONOS IP blocks whose IPs are handed out.
+	IPBlockIDs []string `json:"ipBlockIDs"`
+	// NamespaceSelector restricts the namespaces of Services allowed to use
+	// the pool. An empty selector allows all namespaces.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// ServiceSelector restricts the Services allowed to use the pool. An
+	// empty selector allows all Services.
+	ServiceSelector *metav1.LabelSelector `json:"serviceSelector,omitempty"`
+}
+
+type ipPoolStatus struct {
+	Allocations []ipPoolAllocation `json:"allocations,omitempty"`
+}
+
+// ipPoolAllocation records the IP allocated to a Service.
+type ipPoolAllocation struct {
+	IP         string    `json:"ip"`
+	Namespace  string    `json:"namespace"`
+	Service    string    `json:"service"`
+	ServiceUID types.UID `json:"serviceUID"`
+}
+
+// allocatePoolIP returns the IP allocated to service from the IP pool it is
+// annotated with, allocating the first free IP of the pool if necessary.
+func (l loadbalancer) allocatePoolIP(ctx context.Context, poolName string, service *v1.Service) (string, error) {
+	pool, err := l.getIPPool(ctx, poolName)
+	if err != nil {
+		return "", err
+	}
+	if allocation := pool.allocation(service.UID); allocation != nil {
+		return allocation.IP, nil
+	}
+	if err := l.checkIPPoolSelectors(ctx, pool, service); err != nil {
+		l.recorder.Eventf(service, v1.EventTypeWarning, "IPPoolDenied", "%v", err)
+		return "", err
+	}
+
+	client, err := contractClient(l.ionosClients)
+	if err != nil {
+		return "", err
+	}
+	var ip string
+	for _, id := range pool.Spec.IPBlockIDs {
+		block, err := client.GetIPBlock(ctx, id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get ip block %s of ip pool %s: %w", id, pool.Name, err)
+		}
+		if block == nil {
+			klog.Warningf("ip block %s of ip pool %s does not exist", id, pool.Name)
+			continue
+		}
+		if i := slices.IndexFunc(block.IPs, func(ip string) bool { return !pool.allocated(ip) }); i >= 0 {
+			ip = block.IPs[i]
+			break
+		}
+	}
+	if ip == "" {
+		l.recorder.Eventf(service, v1.EventTypeWarning, "IPPoolExhausted", "IP pool %s has no free IP", pool.Name)
+		return "", fmt.Errorf("ip pool %s has no free ip", pool.Name)
+	}
+
+	pool.Status.Allocations = append(pool.Status.Allocations, ipPoolAllocation{
+		IP:         ip,
+		Namespace:  service.Namespace,
+		Service:    service.Name,
+		ServiceUID: service.UID,
+	})
+	if err := l.updateIPPoolStatus(ctx, pool); err != nil {
+		return "", err
+	}
+	klog.Infof("allocated ip %s of ip pool %s to service %s/%s", ip, pool.Name, service.Namespace, service.Name)
+	l.recorder.Eventf(service, v1.EventTypeNormal, "IPAllocated", "Allocated IP %s from IP pool %s", ip, pool.Name)
+	return ip, nil
+}
+
+// existingPoolIP returns the IP allocated to service from the IP pool or an
+// empty IP.
+func (l loadbalancer) existingPoolIP(ctx context.Context, poolName string, service *v1.Service) (string, error) {
+	pool, err := l.getIPPool(ctx, poolName)
+	if err != nil {
+		return "", err
+	}
+	if allocation := pool.allocation(service.UID); allocation != nil {
+		return allocation.IP, nil
+	}
+	return "", nil
+}
+
+// releasePoolIPs removes the allocations of service from all IP pools but
+// keep, so allocations are released after the pool annotation of service
+// changed or was removed.
+func (l loadbalancer) releasePoolIPs(ctx context.Context, service *v1.Service, keep string) error {
+	pools, err := l.listIPPools(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, pool := range pools {
+		if pool.Name == keep {
+			continue
+		}
+		allocation := pool.allocation(service.UID)
+		if allocation == nil {
+			continue
+		}
+		ip := allocation.IP
+		pool.Status.Allocations = slices.DeleteFunc(pool.Status.Allocations, func(a ipPoolAllocation) bool {
+			return a.ServiceUID == service.UID
+		})
+		if err := l.updateIPPoolStatus(ctx, pool); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		klog.Infof("released ip %s of ip pool %s from service %s/%s", ip, pool.Name, service.Namespace, service.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// listIPPools returns all IP pools. No pools exist if the IPPool resource is
+// not installed.
+func (l loadbalancer) listIPPools(ctx context.Context) ([]*ipPool, error) {
+	if l.kubeClient.dynamic == nil {
+		return nil, errors.New("ip pools are not available before the cloud provider is initialized")
+	}
+	list, err := l.kubeClient.dynamic.Resource(ipPoolResource).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ip pools: %w", err)
+	}
+	pools := make([]*ipPool, 0, len(list.Items))
+	for _, obj := range list.Items {
+		pool := &ipPool{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pool); err != nil {
+			klog.Warningf("skipping invalid ip pool %s: %v", obj.GetName(), err)
+			continue
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+func (l loadbalancer) getIPPool(ctx context.Context, name string) (*ipPool, error) {
+	if l.kubeClient.dynamic == nil {
+		return nil, errors.New("ip pools are not available before the cloud provider is initialized")
+	}
+	obj, err := l.kubeClient.dynamic.Resource(ipPoolResource).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ip pool %s: %w", name, err)
+	}
+	pool := &ipPool{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pool); err != nil {
+		return nil, fmt.Errorf("invalid ip pool %s: %w", name, err)
+	}
+	return pool, nil
+}
+
+// updateIPPoolStatus writes the status of pool. Concurrent allocations fail
+// with a conflict as the resource version of pool is kept.
+func (l loadbalancer) updateIPPoolStatus(ctx context.Context, pool *ipPool) error {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pool)
+	if err != nil {
+		return err
+	}
+	_, err = l.kubeClient.dynamic.Resource(ipPoolResource).UpdateStatus(ctx, &unstructured.Unstructured{Object: obj}, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update status of ip pool %s: %w", pool.Name, err)
+	}
+	return nil
+}
+
+// checkIPPoolSelectors returns an error if service may not use pool.
+func (l loadbalancer) checkIPPoolSelectors(ctx context.Context, pool *ipPool, service *v1.Service) error {
+	if pool.Spec.ServiceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(pool.Spec.ServiceSelector)
+		if err != nil {
+			return fmt.Errorf("invalid service selector of ip pool %s: %w", pool.Name, err)
+		}
+		if !selector.Matches(labels.Set(service.Labels)) {
+			return fmt.Errorf("service %s/%s does not match the service selector of ip pool %s", service.Namespace, service.Name, pool.Name)
+		}
+	}
+	if pool.Spec.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(pool.Spec.NamespaceSelector)
+		if err != nil {
+			return fmt.Errorf("invalid namespace selector of ip pool %s: %w", pool.Name, err)
+		}
+		namespace, err := l.kubeClient.CoreV1().Namespaces().Get(ctx, service.Namespace, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get namespace %s: %w", service.Namespace, err)
+		}
+		if !selector.Matches(labels.Set(namespace.Labels)) {
+			return fmt.Errorf("namespace %s does not match the namespace selector of ip pool %s", service.Namespace, pool.Name)
+		}
+	}
+	return nil
+}
+
+func (p *ipPool) allocation(uid types.UID) *ipPoolAllocation {
+	for i := range p.Status.Allocations {
+		if p.Status.Allocations[i].ServiceUID == uid {
+			return &p.Status.Allocations[i]
+		}
+	}
+	return nil
+}
+
+func (p *ipPool) allocated(ip string) bool {
+	return slices.ContainsFunc(p.Status.Allocations, func(a ipPoolAllocation) bool { return a.IP == ip })
+}
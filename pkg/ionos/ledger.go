@@ -0,0 +1,162 @@
+package ionos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ledgerConfigMapName = "ionoscloud-ccm-attached-ips"
+	ledgerKey           = "attachedIPs"
+)
+
+// ipLedger records which failover IPs the provider attached to which
+// servers in a ConfigMap, so IPs it attached can be told apart from IPs
+// others attached and removed after their Service is gone, even if the
+// provider was down at the time.
+type ipLedger struct {
+	kubeClient *kubeClient
+	namespace  string
+
+	mu sync.Mutex
+	// attached maps IPs to the servers they were attached to, formatted as
+	// <datacenterID>/<serverID>. It is nil until loaded.
+	attached        map[string][]string
+	resourceVersion string
+}
+
+func newIPLedger(kc *kubeClient, namespace string) *ipLedger {
+	if namespace == "" {
+		namespace = metav1.NamespaceSystem
+	}
+	return &ipLedger{kubeClient: kc, namespace: namespace}
+}
+
+// record records that ip was attached to the server.
+func (l *ipLedger) record(ctx context.Context, ip, datacenterID, serverID string) error {
+	return l.update(ctx, func(attached map[string][]string) bool {
+		server := datacenterID + "/" + serverID
+		if slices.Contains(attached[ip], server) {
+			return false
+		}
+		attached[ip] = append(attached[ip], server)
+		return true
+	})
+}
+
+// forget records that ip was removed from the server.
+func (l *ipLedger) forget(ctx context.Context, ip, datacenterID, serverID string) error {
+	return l.update(ctx, func(attached map[string][]string) bool {
+		server := datacenterID + "/" + serverID
+		if !slices.Contains(attached[ip], server) {
+			return false
+		}
+		attached[ip] = slices.DeleteFunc(attached[ip], func(s string) bool { return s == server })
+		if len(attached[ip]) == 0 {
+			delete(attached, ip)
+		}
+		return true
+	})
+}
+
+// entries returns a copy of the recorded IPs and servers.
+func (l *ipLedger) entries(ctx context.Context) (map[string][]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(ctx); err != nil {
+		return nil, err
+	}
+	entries := make(map[string][]string, len(l.attached))
+	for ip, servers := range l.attached {
+		entries[ip] = slices.Clone(servers)
+	}
+	return entries, nil
+}
+
+// hasServer reports whether any IP is recorded for the server.
+func (l *ipLedger) hasServer(ctx context.Context, datacenterID, serverID string) (bool, error) {
+	entries, err := l.entries(ctx)
+	if err != nil {
+		return false, err
+	}
+	server := datacenterID + "/" + serverID
+	for _, servers := range entries {
+		if slices.Contains(servers, server) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// update applies fn to the recorded IPs and writes them if fn reports a
+// change. The cache is dropped if writing fails, so it is reloaded next time.
+func (l *ipLedger) update(ctx context.Context, fn func(map[string][]string) bool) error {
+	if l.kubeClient.Interface == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(ctx); err != nil {
+		return err
+	}
+	attached := maps.Clone(l.attached)
+	if !fn(attached) {
+		return nil
+	}
+	data, err := json.Marshal(attached)
+	if err != nil {
+		return err
+	}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ledgerConfigMapName, Namespace: l.namespace, ResourceVersion: l.resourceVersion},
+		Data:       map[string]string{ledgerKey: string(data)},
+	}
+	configMaps := l.kubeClient.CoreV1().ConfigMaps(l.namespace)
+	if l.resourceVersion == "" {
+		configMap, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	} else {
+		configMap, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		l.attached = nil
+		return fmt.Errorf("failed to write configmap %s/%s: %w", l.namespace, ledgerConfigMapName, err)
+	}
+	l.attached = attached
+	l.resourceVersion = configMap.ResourceVersion
+	return nil
+}
+
+func (l *ipLedger) load(ctx context.Context) error {
+	if l.attached != nil {
+		return nil
+	}
+	if l.kubeClient.Interface == nil {
+		l.attached, l.resourceVersion = map[string][]string{}, ""
+		return nil
+	}
+	configMap, err := l.kubeClient.CoreV1().ConfigMaps(l.namespace).Get(ctx, ledgerConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		l.attached, l.resourceVersion = map[string][]string{}, ""
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s/%s: %w", l.namespace, ledgerConfigMapName, err)
+	}
+	attached := map[string][]string{}
+	if data, ok := configMap.Data[ledgerKey]; ok {
+		if err := json.Unmarshal([]byte(data), &attached); err != nil {
+			klog.Errorf("ignoring invalid configmap %s/%s: %v", l.namespace, ledgerConfigMapName, err)
+		}
+	}
+	l.attached, l.resourceVersion = attached, configMap.ResourceVersion
+	return nil
+}
@@ -0,0 +1,68 @@
+package ionos
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+var (
+	defaultShutdownVMStates = []string{"PAUSED", "SHUTDOWN", "SHUTOFF", "CRASHED", "SUSPENDED"}
+	defaultShutdownStates   = []string{"INACTIVE", "DEPROVISIONING", "FAILED"}
+	// runningVMStates are the VM states of a server which is up. BLOCKED means
+	// the VM is waiting for I/O and NOSTATE is reported while booting.
+	runningVMStates = sets.New("RUNNING", "NOSTATE", "BLOCKED")
+)
+
+// lifecycle decides whether a server state means shut down or deleted.
+type lifecycle struct {
+	shutdownVMStates sets.Set[string]
+	shutdownStates   sets.Set[string]
+	deletedStates    sets.Set[string]
+}
+
+func newLifecycle(cfg config.LifecycleConfig) lifecycle {
+	return lifecycle{
+		shutdownVMStates: upperSet(cfg.ShutdownVMStates, defaultShutdownVMStates),
+		shutdownStates:   upperSet(cfg.ShutdownStates, defaultShutdownStates),
+		deletedStates:    upperSet(cfg.DeletedStates, nil),
+	}
+}
+
+// upperSet returns the upper cased values. Only missing values fall back to
+// the defaults, an empty list configures no value.
+func upperSet(values, defaults []string) sets.Set[string] {
+	if values == nil {
+		values = defaults
+	}
+	s := sets.New[string]()
+	for _, v := range values {
+		s.Insert(strings.ToUpper(v))
+	}
+	return s
+}
+
+// isShutdown reports whether the server is shut down. The resource state wins
+// over the VM state, as a server being deprovisioned may still report RUNNING.
+func (l lifecycle) isShutdown(state client2.ServerState) bool {
+	if l.shutdownStates.Has(state.State) {
+		return true
+	}
+	if l.shutdownVMStates.Has(state.VMState) {
+		return true
+	}
+	if state.VMState != "" && !runningVMStates.Has(state.VMState) {
+		klog.Warningf("unknown vm state %s (state %s, type %s), assuming the server is not shut down", state.VMState, state.State, state.Type)
+	}
+	return false
+}
+
+// isDeleted reports whether the server has to be treated as gone although
+// the API still returns it.
+func (l lifecycle) isDeleted(state client2.ServerState) bool {
+	return l.deletedStates.Has(state.State)
+}
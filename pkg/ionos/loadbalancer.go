@@ -3,13 +3,16 @@ package ionos
 import (
 	"context"
 	"errors"
-	"strings"
+	"fmt"
+	"sync"
 
 	v1 "k8s.io/api/core/v1"
 	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
 	"k8s.io/klog/v2"
 
 	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
 )
 
 var _ cloudprovider.LoadBalancer = &loadbalancer{}
@@ -18,7 +21,7 @@ var _ cloudprovider.LoadBalancer = &loadbalancer{}
 
 func (l loadbalancer) AddClient(datacenterId string, token []byte) error {
 	if l.ionosClients[datacenterId] == nil {
-		c, err := client2.New(datacenterId, token)
+		c, err := client2.New(datacenterId, token, l.clientOptions)
 		if err != nil {
 			return err
 		}
@@ -34,16 +37,32 @@ func (l loadbalancer) AddClient(datacenterId string, token []byte) error {
 // For the given LB service, the GetLoadBalancer must return "exists=True" if
 // there exists a LoadBalancer instance created by ServiceController.
 // In all other cases, GetLoadBalancer must return a NotFound error.
-func (l loadbalancer) GetLoadBalancer(ctx context.Context, _ string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
+func (l loadbalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
 	klog.Infof("getLoadBalancer (service %s/%s)", service.Namespace, service.Name)
+	mode, err := l.mode(service)
+	if err != nil {
+		return nil, false, err
+	}
+	switch mode {
+	case config.LoadBalancerModeNLB, config.LoadBalancerModeALB:
+		return l.managed(mode).GetLoadBalancer(ctx, l.GetLoadBalancerName(ctx, clusterName, service))
+	}
+
+	loadBalancerIP, err := l.existingLoadBalancerIP(ctx, service)
+	if err != nil || loadBalancerIP == "" {
+		return nil, false, err
+	}
+	if mode == config.LoadBalancerModeIPAM {
+		return ingressStatus([]string{loadBalancerIP}), true, nil
+	}
 
-	server, err := l.ServerWithLoadBalancer(ctx, service.Spec.LoadBalancerIP)
+	server, err := l.ServerWithLoadBalancer(ctx, loadBalancerIP)
 	if err != nil {
 		return nil, false, err
 	}
 
 	if server != nil {
-		return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: service.Spec.LoadBalancerIP}}}, true, nil
+		return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: loadBalancerIP}}}, true, nil
 	}
 
 	return nil, false, nil
@@ -66,7 +85,7 @@ func (l loadbalancer) GetLoadBalancerName(_ context.Context, _ string, service *
 // polling at a fixed rate is preferred over backing off exponentially in
 // order to minimize latency.
 func (l loadbalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
-	return l.syncLoadBalancer(ctx, clusterName, service, nodes)
+	return l.ensureLoadBalancer(ctx, clusterName, service, nodes)
 }
 
 // UpdateLoadBalancer updates hosts under the specified load balancer.
@@ -74,7 +93,7 @@ func (l loadbalancer) EnsureLoadBalancer(ctx context.Context, clusterName string
 // parameters as read-only and not modify them.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (l loadbalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
-	_, err := l.syncLoadBalancer(ctx, clusterName, service, nodes)
+	_, err := l.ensureLoadBalancer(ctx, clusterName, service, nodes)
 	return err
 }
 
@@ -88,9 +107,23 @@ func (l loadbalancer) UpdateLoadBalancer(ctx context.Context, clusterName string
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 // EnsureLoadBalancerDeleted must not return ImplementedElsewhere to ensure
 // proper teardown of resources that were allocated by the ServiceController.
-func (l loadbalancer) EnsureLoadBalancerDeleted(ctx context.Context, _ string, service *v1.Service) error {
+func (l loadbalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
 	klog.Infof("ensureLoadBalancerDeleted (service %s/%s)", service.Namespace, service.Name)
+	modes := []string{l.activeMode(service)}
+	if mode, err := l.mode(service); err == nil && mode != modes[0] {
+		modes = append(modes, mode)
+	}
+	for _, mode := range modes {
+		if err := l.deleteBackend(ctx, mode, clusterName, service); err != nil {
+			return err
+		}
+	}
+	return l.releaseIP(ctx, service)
+}
 
+// deleteFailoverIP removes the load balancer IP of service from the node it
+// is attached to.
+func (l loadbalancer) deleteFailoverIP(ctx context.Context, service *v1.Service) error {
 	if len(service.Status.LoadBalancer.Ingress) > 0 {
 		klog.Infof("removing IP %s", service.Status.LoadBalancer.Ingress[0].IP)
 		server, err := l.ServerWithLoadBalancer(ctx, service.Status.LoadBalancer.Ingress[0].IP)
@@ -100,7 +133,7 @@ func (l loadbalancer) EnsureLoadBalancerDeleted(ctx context.Context, _ string, s
 
 		if server != nil {
 			if err := l.deleteLoadBalancerFromNode(ctx, service.Status.LoadBalancer.Ingress[0].IP, server); err != nil {
-				return err
+				return l.reportConflict(service, err)
 			}
 		}
 	}
@@ -120,7 +153,14 @@ func (l loadbalancer) deleteLoadBalancerFromNode(ctx context.Context, loadBalanc
 		}
 
 		if server != nil {
-			return client.RemoveIPFromNode(ctx, loadBalancerIP, server.ProviderID)
+			if err := l.checkServerOwner(ctx, client, *server, l.knownNodes()); err != nil {
+				return err
+			}
+			if err := client.RemoveIPFromNode(ctx, loadBalancerIP, server.ProviderID); err != nil {
+				return err
+			}
+			l.forgetIP(ctx, loadBalancerIP, client.DatacenterId, server.ProviderID)
+			return nil
 		}
 	}
 
@@ -128,11 +168,12 @@ func (l loadbalancer) deleteLoadBalancerFromNode(ctx context.Context, loadBalanc
 	return nil
 }
 
-func (l loadbalancer) syncLoadBalancer(ctx context.Context, _ string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+func (l loadbalancer) syncLoadBalancer(ctx context.Context, loadBalancerIP string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
 	klog.Infof("syncLoadBalancer (service %s/%s, nodes %s)", service.Namespace, service.Name, nodes)
+	defer l.locks.lock(service)()
 
-	if len(service.Status.LoadBalancer.Ingress) > 0 && service.Status.LoadBalancer.Ingress[0].IP != service.Spec.LoadBalancerIP {
-		klog.Infof("service %s/%s changed IP from %s to %s", service.Namespace, service.Name, service.Status.LoadBalancer.Ingress[0].IP, service.Spec.LoadBalancerIP)
+	if len(service.Status.LoadBalancer.Ingress) > 0 && service.Status.LoadBalancer.Ingress[0].IP != loadBalancerIP {
+		klog.Infof("service %s/%s changed IP from %s to %s", service.Namespace, service.Name, service.Status.LoadBalancer.Ingress[0].IP, loadBalancerIP)
 		server, err := l.ServerWithLoadBalancer(ctx, service.Status.LoadBalancer.Ingress[0].IP)
 		if err != nil {
 			return nil, err
@@ -140,81 +181,200 @@ func (l loadbalancer) syncLoadBalancer(ctx context.Context, _ string, service *v
 
 		if server != nil {
 			if err := l.deleteLoadBalancerFromNode(ctx, service.Status.LoadBalancer.Ingress[0].IP, server); err != nil {
-				return nil, err
+				return nil, l.reportConflict(service, err)
 			}
 		}
 	}
 
-	if service.Spec.LoadBalancerIP == "" {
-		return nil, errors.New("we are only handling LoadBalancers with spec.loadBalancerID != ''")
+	key := service.Namespace + "/" + service.Name
+	if stale, ok := l.stale.get(key); ok {
+		if err := l.removeIPFromServer(ctx, stale.ip, &stale.server); err != nil {
+			return nil, cloudproviderapi.NewRetryError(fmt.Sprintf("failed to remove ip %s from previous server %s: %v",
+				stale.ip, stale.server.Name, err), provisioningRetryDelay)
+		}
+		l.stale.clear(key)
 	}
 
-	server, err := l.ServerWithLoadBalancer(ctx, service.Spec.LoadBalancerIP)
+	server, err := l.ServerWithLoadBalancer(ctx, loadBalancerIP)
 	if err != nil {
 		return nil, err
 	}
 
+	var holder *v1.Node
 	if server != nil {
-		klog.Infof("found server %s has IP %s ", server, service.Spec.LoadBalancerIP)
-		node := getNode(*server, nodes)
-		if node == nil {
-			return nil, errors.New("no node found for server which has loadbalancerIP attached")
+		klog.Infof("found server %s has IP %s ", server, loadBalancerIP)
+		holder = getNode(*server, nodes)
+		if holder == nil {
+			// The service controller does not pass nodes excluded from load
+			// balancers, which may still hold the IP.
+			holder = getNode(*server, l.knownNodes())
 		}
-
-		if IsLoadBalancerCandidate(node) {
-			klog.Infof("server %s is valid loadbalancer node", server)
-			return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{
-				IP: service.Spec.LoadBalancerIP,
-			}}}, nil
+		client, ok := l.ionosClients[server.DatacenterID]
+		if !ok {
+			return nil, fmt.Errorf("no client configured for datacenter %s", server.DatacenterID)
+		}
+		var holders []*v1.Node
+		if holder != nil {
+			holders = append(holders, holder)
+		}
+		if err := l.checkServerOwner(ctx, client, *server, holders); err != nil {
+			return nil, l.reportConflict(service, fmt.Errorf("ip %s is attached to server %s: %w", loadBalancerIP, server.Name, err))
+		}
+		if holder == nil {
+			// The Node of the server was deleted while the server still
+			// holds the IP, so it is moved off like from a dead node.
+			klog.Infof("server %s holding ip %s is no node of the cluster anymore, moving the ip", server.Name, loadBalancerIP)
 		}
 	}
 
-	loadBalancerNode := l.GetLoadBalancerNode(nodes)
-
-	if loadBalancerNode == nil {
-		return nil, errors.New("no valid nodes found")
+	loadBalancerNode, err := l.electNode(ctx, service, nodes, holder)
+	if err != nil {
+		return nil, err
+	}
+	if holder != nil && holder != loadBalancerNode {
+		if retryAfter, err := l.hysteresis.checkMove(key); err != nil {
+			l.recorder.Eventf(service, v1.EventTypeWarning, "FailoverRateLimited",
+				"Not moving IP %s from node %s to %s: %v", loadBalancerIP, holder.Name, loadBalancerNode.Name, err)
+			return nil, cloudproviderapi.NewRetryError(err.Error(), retryAfter)
+		}
 	}
-	klog.Infof("server %s is elected as new loadbalancer node", loadBalancerNode)
 
-	for _, client := range l.ionosClients {
-		ok, err := client.AttachIPToNode(ctx, service.Spec.LoadBalancerIP, stripProviderFromID(loadBalancerNode.Spec.ProviderID))
+	providerID, err := providerIDFromNode(loadBalancerNode)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := clientsFor(l.ionosClients, providerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		selector := nicSelector(loadBalancerNode, l.datacenters, client.DatacenterId)
+		ok, err := client.AttachIPToNode(ctx, loadBalancerIP, providerID.ServerID, selector)
+		if errors.Is(err, client2.ErrNoMatchingNIC) {
+			l.recorder.Eventf(service, v1.EventTypeWarning, "NoMatchingNIC",
+				"Cannot attach IP %s to node %s: %v", loadBalancerIP, loadBalancerNode.Name, err)
+		}
 		if err != nil {
 			return nil, err
 		}
 
 		if ok {
-			klog.Infof("successfully attached ip %s to server %s", service.Spec.LoadBalancerIP, server)
+			klog.Infof("successfully attached ip %s to server %s", loadBalancerIP, providerID)
+			var removeErr error
+			if server != nil && holder != loadBalancerNode {
+				// The IP failover entry already points to the new node. The
+				// IP is removed before anything else can fail the sync, and
+				// the removal is retried by the next sync if it fails.
+				if removeErr = l.removeIPFromServer(ctx, loadBalancerIP, server); removeErr != nil {
+					l.stale.set(key, staleHolder{ip: loadBalancerIP, server: *server})
+				}
+			}
+			if err := l.claimServer(ctx, client, providerID.ServerID); err != nil {
+				return nil, l.reportConflict(service, err)
+			}
+			if err := l.ledger.record(ctx, loadBalancerIP, client.DatacenterId, providerID.ServerID); err != nil {
+				klog.Warningf("failed to record ip %s of server %s: %v", loadBalancerIP, providerID, err)
+			}
+			if holder != loadBalancerNode {
+				l.hysteresis.placed(key)
+				if holder != nil {
+					l.hysteresis.recordMove(key)
+				}
+			}
+			if err := l.recordAnnotation(ctx, service, annotationLoadBalancerNode, loadBalancerNode.Name); err != nil {
+				return nil, err
+			}
+			if holder != loadBalancerNode {
+				if err := l.recordHomeNode(ctx, service, holder, loadBalancerNode); err != nil {
+					return nil, err
+				}
+			}
+			if removeErr != nil {
+				return nil, cloudproviderapi.NewRetryError(fmt.Sprintf("failed to remove ip %s from previous server %s: %v",
+					loadBalancerIP, server.Name, removeErr), provisioningRetryDelay)
+			}
 			return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{
-				IP: service.Spec.LoadBalancerIP,
+				IP: loadBalancerIP,
 			}}}, nil
 		}
 	}
 
-	klog.Infof("could not attach ip %s to any node", service.Spec.LoadBalancerIP)
+	klog.Infof("could not attach ip %s to any node", loadBalancerIP)
 	return nil, nil
 }
 
-func getNode(server client2.Server, nodes []*v1.Node) *v1.Node {
-	for _, node := range nodes {
-		if stripProviderFromID(node.Spec.ProviderID) == server.ProviderID {
-			return node
-		}
+// staleHolders remembers the servers a failover IP could not be removed from
+// after it moved, so the next sync of the Service retries the removal before
+// the IP is looked up, which would find either server.
+type staleHolders struct {
+	mu      sync.Mutex
+	holders map[string]staleHolder
+}
+
+type staleHolder struct {
+	ip     string
+	server client2.Server
+}
+
+func (s *staleHolders) set(key string, holder staleHolder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holders == nil {
+		s.holders = map[string]staleHolder{}
+	}
+	s.holders[key] = holder
+}
+
+func (s *staleHolders) get(key string) (staleHolder, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	holder, ok := s.holders[key]
+	return holder, ok
+}
+
+func (s *staleHolders) clear(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.holders, key)
+}
+
+// removeIPFromServer removes loadBalancerIP from the given server, unlike
+// deleteLoadBalancerFromNode which removes it from any server having it.
+func (l loadbalancer) removeIPFromServer(ctx context.Context, loadBalancerIP string, server *client2.Server) error {
+	client, ok := l.ionosClients[server.DatacenterID]
+	if !ok {
+		return fmt.Errorf("no client configured for datacenter %s", server.DatacenterID)
 	}
+	if err := l.checkServerOwner(ctx, client, *server, l.knownNodes()); err != nil {
+		return err
+	}
+	if err := client.RemoveIPFromNode(ctx, loadBalancerIP, server.ProviderID); err != nil {
+		return err
+	}
+	l.forgetIP(ctx, loadBalancerIP, server.DatacenterID, server.ProviderID)
 	return nil
 }
 
-func (l loadbalancer) GetLoadBalancerNode(nodes []*v1.Node) *v1.Node {
-	var candidates []*v1.Node
+// forgetIP removes the IP from the ledger of attached IPs. Failures are only
+// logged, as they at most delay the garbage collection of the IP.
+func (l loadbalancer) forgetIP(ctx context.Context, loadBalancerIP, datacenterID, serverID string) {
+	if err := l.ledger.forget(ctx, loadBalancerIP, datacenterID, serverID); err != nil {
+		klog.Warningf("failed to forget ip %s of server %s: %v", loadBalancerIP, serverID, err)
+	}
+}
+
+func getNode(server client2.Server, nodes []*v1.Node) *v1.Node {
 	for _, node := range nodes {
-		if IsLoadBalancerCandidate(node) {
-			candidates = append(candidates, node)
+		providerID, err := providerIDFromNode(node)
+		if err != nil {
+			klog.Warningf("skipping node %s: %v", node.Name, err)
+			continue
+		}
+		if providerID.ServerID == server.ProviderID {
+			return node
 		}
 	}
-	if candidates == nil && len(candidates) == 0 {
-		return nil
-	}
-	randomIndex := l.r.Intn(len(candidates))
-	return candidates[randomIndex]
+	return nil
 }
 
 func (l loadbalancer) ServerWithLoadBalancer(ctx context.Context, loadBalancerIP string) (*client2.Server, error) {
@@ -241,8 +401,3 @@ func IsLoadBalancerCandidate(node *v1.Node) bool {
 	}
 	return false
 }
-
-func stripProviderFromID(providerID string) string {
-	s, _ := strings.CutPrefix(providerID, "ionos://")
-	return s
-}
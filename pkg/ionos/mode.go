@@ -0,0 +1,201 @@
+package ionos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// managedLoadBalancer is a load balancer IONOS provisions for a Service.
+type managedLoadBalancer interface {
+	GetLoadBalancer(ctx context.Context, name string) (*v1.LoadBalancerStatus, bool, error)
+	EnsureLoadBalancer(ctx context.Context, name, loadBalancerIP string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error)
+	EnsureLoadBalancerDeleted(ctx context.Context, name string) error
+}
+
+// managed returns the managed load balancer of mode.
+func (l loadbalancer) managed(mode string) managedLoadBalancer {
+	if mode == config.LoadBalancerModeALB {
+		return l.alb
+	}
+	return l.nlb
+}
+
+// mode returns the load balancer implementation requested for service. The
+// mode annotation wins over the layer annotation, which wins over the
+// default of the cloud config.
+func (l loadbalancer) mode(service *v1.Service) (string, error) {
+	layer := service.Annotations[annotationLoadBalancerLayer]
+	switch layer {
+	case "", "4", "7":
+	default:
+		return "", fmt.Errorf("annotation %s must be 4 or 7, got %q", annotationLoadBalancerLayer, layer)
+	}
+	mode, ok := service.Annotations[annotationLoadBalancerMode]
+	if !ok {
+		if layer == "7" {
+			return config.LoadBalancerModeALB, nil
+		}
+		return l.defaultMode(), nil
+	}
+	switch mode {
+	case config.LoadBalancerModeFailoverIP, config.LoadBalancerModeIPAM:
+	case config.LoadBalancerModeNLB:
+		if !l.config.NLB.IsConfigured() {
+			return "", fmt.Errorf("annotation %s requests %s, but loadBalancer.nlb is not configured", annotationLoadBalancerMode, mode)
+		}
+	case config.LoadBalancerModeALB:
+		if !l.config.ALB.IsConfigured() {
+			return "", fmt.Errorf("annotation %s requests %s, but loadBalancer.alb is not configured", annotationLoadBalancerMode, mode)
+		}
+	default:
+		return "", fmt.Errorf("annotation %s must be one of %s, %s, %s or %s, got %q", annotationLoadBalancerMode,
+			config.LoadBalancerModeFailoverIP, config.LoadBalancerModeNLB, config.LoadBalancerModeALB, config.LoadBalancerModeIPAM, mode)
+	}
+	if layer == "7" && mode != config.LoadBalancerModeALB {
+		return "", fmt.Errorf("layer 7 is only supported by mode %s, got %s", config.LoadBalancerModeALB, mode)
+	}
+	return mode, nil
+}
+
+func (l loadbalancer) defaultMode() string {
+	if l.config.Mode == "" {
+		return config.LoadBalancerModeFailoverIP
+	}
+	return l.config.Mode
+}
+
+// activeMode returns the mode the load balancer of service was last ready in.
+// Services which were set up before modes were recorded are assumed to use
+// the mode they get without a mode annotation.
+func (l loadbalancer) activeMode(service *v1.Service) string {
+	if mode, ok := service.Annotations[annotationLoadBalancerActiveMode]; ok {
+		return mode
+	}
+	if service.Annotations[annotationLoadBalancerLayer] == "7" {
+		return config.LoadBalancerModeALB
+	}
+	return l.defaultMode()
+}
+
+// ensureLoadBalancer ensures the load balancer of service in its requested
+// mode. When the mode changed, the backend of the previous mode is only torn
+// down once the new one is ready, so the Service stays reachable. IONOS does
+// not allow an IP on a NIC and a load balancer at the same time, so backends
+// sharing the IP are torn down first.
+func (l loadbalancer) ensureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	mode, err := l.mode(service)
+	if err != nil {
+		return nil, err
+	}
+	loadBalancerIP, err := l.loadBalancerIP(ctx, clusterName, mode, service)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.claimIP(ctx, loadBalancerIP, service); err != nil {
+		return nil, err
+	}
+	previous := l.activeMode(service)
+	tornDown := false
+	if previous != mode && sharesIP(service, previous, mode, loadBalancerIP) {
+		klog.Infof("tearing down %s backend of service %s/%s before migrating to %s, as both use ip %s",
+			previous, service.Namespace, service.Name, mode, loadBalancerIP)
+		if err := l.deleteBackend(ctx, previous, clusterName, service); err != nil {
+			return nil, fmt.Errorf("failed to tear down %s backend: %w", previous, err)
+		}
+		tornDown = true
+	}
+	var status *v1.LoadBalancerStatus
+	switch mode {
+	case config.LoadBalancerModeNLB, config.LoadBalancerModeALB:
+		status, err = l.managed(mode).EnsureLoadBalancer(ctx, l.GetLoadBalancerName(ctx, clusterName, service), loadBalancerIP, service, nodes)
+	case config.LoadBalancerModeIPAM:
+		status = ingressStatus([]string{loadBalancerIP})
+	default:
+		status, err = l.syncLoadBalancer(ctx, loadBalancerIP, service, nodes)
+	}
+	if err != nil || status == nil {
+		return status, err
+	}
+
+	if previous != mode {
+		klog.Infof("migrating load balancer of service %s/%s from %s to %s", service.Namespace, service.Name, previous, mode)
+		if !tornDown {
+			if err := l.deleteBackend(ctx, previous, clusterName, service); err != nil {
+				return nil, fmt.Errorf("failed to tear down %s backend: %w", previous, err)
+			}
+		}
+		l.recorder.Eventf(service, v1.EventTypeNormal, "LoadBalancerMigrated", "Migrated load balancer from %s to %s", previous, mode)
+	}
+	if err := l.recordAnnotation(ctx, service, annotationLoadBalancerActiveMode, mode); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// sharesIP reports whether the backends of service in the modes both hold
+// loadBalancerIP at IONOS. IPAM mode does not hold the IP.
+func sharesIP(service *v1.Service, previous, mode, loadBalancerIP string) bool {
+	if previous == config.LoadBalancerModeIPAM || mode == config.LoadBalancerModeIPAM {
+		return false
+	}
+	ingress := service.Status.LoadBalancer.Ingress
+	return len(ingress) > 0 && ingress[0].IP == loadBalancerIP
+}
+
+// deleteBackend tears down the backend of service in mode.
+func (l loadbalancer) deleteBackend(ctx context.Context, mode, clusterName string, service *v1.Service) error {
+	switch mode {
+	case config.LoadBalancerModeNLB, config.LoadBalancerModeALB:
+		return l.managed(mode).EnsureLoadBalancerDeleted(ctx, l.GetLoadBalancerName(ctx, clusterName, service))
+	case config.LoadBalancerModeIPAM:
+		return nil
+	default:
+		return l.deleteFailoverIP(ctx, service)
+	}
+}
+
+// recordAnnotation records state of the load balancer in an annotation of
+// service, as the service controller does not pass the previous state of a
+// Service.
+func (l loadbalancer) recordAnnotation(ctx context.Context, service *v1.Service, key, value string) error {
+	if current, ok := service.Annotations[key]; ok && current == value {
+		return nil
+	}
+	return l.patchAnnotation(ctx, service, key, &value)
+}
+
+// clearAnnotation removes an annotation recorded by recordAnnotation.
+func (l loadbalancer) clearAnnotation(ctx context.Context, service *v1.Service, key string) error {
+	if _, ok := service.Annotations[key]; !ok {
+		return nil
+	}
+	return l.patchAnnotation(ctx, service, key, nil)
+}
+
+// patchAnnotation sets the annotation of service to value or removes it if
+// value is nil.
+func (l loadbalancer) patchAnnotation(ctx context.Context, service *v1.Service, key string, value *string) error {
+	if l.kubeClient.Interface == nil {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]*string{key: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := l.kubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to update annotation %s of service %s/%s: %w", key, service.Namespace, service.Name, err)
+	}
+	return nil
+}
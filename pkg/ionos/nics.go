@@ -0,0 +1,65 @@
+package ionos
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// syncNICAnnotation keeps the NIC annotation of node in sync with the NICs
+// of its server. InstanceMetadata is called periodically by the node
+// controller, so the annotation follows changes of the NICs. Failures are
+// logged only, as they must not block node initialization.
+func (i instances) syncNICAnnotation(ctx context.Context, node *v1.Node, nics []client2.NIC) {
+	if node.Name == "" || i.kubeClient.Interface == nil {
+		return
+	}
+	if nics == nil {
+		nics = []client2.NIC{}
+	}
+	value, err := json.Marshal(nics)
+	if err != nil {
+		klog.Errorf("failed to marshal nics of node %s: %v", node.Name, err)
+		return
+	}
+	if node.Annotations[annotationNICs] == string(value) {
+		return
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{annotationNICs: string(value)},
+		},
+	})
+	if err != nil {
+		klog.Errorf("failed to create patch for node %s: %v", node.Name, err)
+		return
+	}
+	if _, err := i.kubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		klog.Errorf("failed to update annotation %s of node %s: %v", annotationNICs, node.Name, err)
+		return
+	}
+	klog.V(2).Infof("updated annotation %s of node %s", annotationNICs, node.Name)
+}
+
+// nicSelector returns the selector for the NIC load balancer IPs are attached
+// to on node in the given datacenter. The node annotation wins over the
+// datacenter configuration.
+func nicSelector(node *v1.Node, datacenters map[string]config.DatacenterConfig, datacenterID string) config.NICSelector {
+	if value := strings.TrimSpace(node.Annotations[annotationPrimaryNIC]); value != "" {
+		if uuid.Validate(value) == nil {
+			return config.NICSelector{ID: value}
+		}
+		return config.NICSelector{NamePattern: "^" + regexp.QuoteMeta(value) + "$"}
+	}
+	return datacenters[datacenterID].PrimaryNIC
+}
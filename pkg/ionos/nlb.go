@@ -0,0 +1,160 @@
+package ionos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// provisioningRetryDelay is how long the service controller waits before
+// checking a load balancer IONOS is still provisioning.
+const provisioningRetryDelay = 30 * time.Second
+
+// networkLoadBalancer provisions an IONOS Network Load Balancer per Service
+// which forwards every Service port to the NodePort of all eligible nodes.
+type networkLoadBalancer struct {
+	config       config.ManagedLoadBalancerConfig
+	ionosClients map[string]*client2.IONOSClient
+}
+
+func (n networkLoadBalancer) GetLoadBalancer(ctx context.Context, name string) (*v1.LoadBalancerStatus, bool, error) {
+	client, err := datacenterClient(n.ionosClients, n.config.DatacenterID)
+	if err != nil {
+		return nil, false, err
+	}
+	nlb, err := client.GetNetworkLoadBalancer(ctx, name)
+	if err != nil || nlb == nil {
+		return nil, false, err
+	}
+	return ingressStatus(nlb.IPs), true, nil
+}
+
+func (n networkLoadBalancer) EnsureLoadBalancer(ctx context.Context, name, loadBalancerIP string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	klog.Infof("ensureNetworkLoadBalancer %s (service %s/%s)", name, service.Namespace, service.Name)
+	client, err := datacenterClient(n.ionosClients, n.config.DatacenterID)
+	if err != nil {
+		return nil, err
+	}
+	targets := nodeTargets(nodes, n.config.TargetLan)
+	if len(targets) == 0 {
+		return nil, errors.New("no valid nodes found")
+	}
+
+	desired := client2.NetworkLoadBalancer{
+		Name:        name,
+		IPs:         []string{loadBalancerIP},
+		ListenerLan: n.config.ListenerLan,
+		TargetLan:   n.config.TargetLan,
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Protocol != v1.ProtocolTCP {
+			return nil, fmt.Errorf("port %d: protocol %s is not supported by network load balancers", port.Port, port.Protocol)
+		}
+		rule := client2.ForwardingRule{
+			Name:         fmt.Sprintf("%s-%d", strings.ToLower(string(port.Protocol)), port.Port),
+			Protocol:     string(port.Protocol),
+			ListenerIP:   loadBalancerIP,
+			ListenerPort: port.Port,
+		}
+		for _, ip := range targets {
+			rule.Targets = append(rule.Targets, client2.ForwardingTarget{IP: ip, Port: port.NodePort})
+		}
+		desired.Rules = append(desired.Rules, rule)
+	}
+
+	nlb, err := client.EnsureNetworkLoadBalancer(ctx, desired)
+	if err != nil {
+		return nil, err
+	}
+	if !nlb.Ready() {
+		return nil, cloudproviderapi.NewRetryError(fmt.Sprintf("network load balancer %s is %s", name, nlb.State), provisioningRetryDelay)
+	}
+	return ingressStatus(nlb.IPs), nil
+}
+
+func (n networkLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, name string) error {
+	klog.Infof("ensureNetworkLoadBalancerDeleted %s", name)
+	client, err := datacenterClient(n.ionosClients, n.config.DatacenterID)
+	if err != nil {
+		return err
+	}
+	return client.DeleteNetworkLoadBalancer(ctx, name)
+}
+
+// datacenterClient returns the client of the datacenter load balancer
+// resources are created in, which defaults to the only configured datacenter.
+func datacenterClient(ionosClients map[string]*client2.IONOSClient, datacenterID string) (*client2.IONOSClient, error) {
+	if datacenterID != "" {
+		client, ok := ionosClients[datacenterID]
+		if !ok {
+			return nil, fmt.Errorf("no client configured for load balancer datacenter %s", datacenterID)
+		}
+		return client, nil
+	}
+	if len(ionosClients) != 1 {
+		return nil, fmt.Errorf("%d datacenters configured, datacenterID of the load balancer has to be set", len(ionosClients))
+	}
+	for _, client := range ionosClients {
+		return client, nil
+	}
+	return nil, nil
+}
+
+// nodeTargets returns the IPs managed load balancers reach the eligible nodes
+// with. These are the IPs of the NICs in the target LAN, falling back to the
+// internal IP of nodes without NIC annotation. Nodes whose NICs are known but
+// not in the target LAN are skipped, as they are not reachable.
+func nodeTargets(nodes []*v1.Node, targetLan int32) []string {
+	var ips []string
+	for _, node := range nodes {
+		if !IsLoadBalancerCandidate(node) {
+			continue
+		}
+		if ip := nodeIPInLan(node, targetLan); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func nodeIPInLan(node *v1.Node, lanID int32) string {
+	value, ok := node.Annotations[annotationNICs]
+	if !ok {
+		for _, address := range node.Status.Addresses {
+			if address.Type == v1.NodeInternalIP {
+				return address.Address
+			}
+		}
+		return ""
+	}
+	var nics []client2.NIC
+	if err := json.Unmarshal([]byte(value), &nics); err != nil {
+		klog.Warningf("skipping node %s as target, it has an invalid %s annotation: %v", node.Name, annotationNICs, err)
+		return ""
+	}
+	for _, nic := range nics {
+		if nic.LanID == lanID && len(nic.IPs) > 0 {
+			return nic.IPs[0]
+		}
+	}
+	klog.Warningf("skipping node %s as target, it has no nic with an ip in lan %d", node.Name, lanID)
+	return ""
+}
+
+func ingressStatus(ips []string) *v1.LoadBalancerStatus {
+	status := &v1.LoadBalancerStatus{}
+	for _, ip := range ips {
+		status.Ingress = append(status.Ingress, v1.LoadBalancerIngress{IP: ip})
+	}
+	return status
+}
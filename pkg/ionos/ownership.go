@@ -0,0 +1,141 @@
+package ionos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+)
+
+// ownershipConflict is the error of touching an IP or server owned by
+// someone else.
+type ownershipConflict struct {
+	message string
+}
+
+func (c *ownershipConflict) Error() string {
+	return c.message
+}
+
+func conflict(format string, args ...any) error {
+	return &ownershipConflict{message: fmt.Sprintf(format, args...)}
+}
+
+// claimIP verifies that the IP block of ip is not reserved for another
+// Service and not labeled for another cluster. Unlabeled blocks of a single
+// IP are labeled for the cluster; larger blocks may be shared by clusters and
+// are left alone. IPs outside the IP blocks of the contract are not checked,
+// and clusters are only told apart if clusterID is configured.
+func (l loadbalancer) claimIP(ctx context.Context, ip string, service *v1.Service) error {
+	owner := l.clientOptions.ClusterID
+	if owner == "" {
+		return nil
+	}
+	client, err := contractClient(l.ionosClients)
+	if err != nil {
+		return err
+	}
+	block, err := client.IPBlockOfIP(ctx, ip)
+	if err != nil || block == nil {
+		return err
+	}
+	// Blocks reserved for a Service are identified by its UID, as they may
+	// be labeled with the cluster name from before clusterID was set.
+	if uid, ok := block.Labels[labelServiceUID]; ok {
+		if uid != string(service.UID) {
+			return l.reportConflict(service, conflict("ip %s belongs to ip block %s of service %s/%s", ip, block.ID,
+				block.Labels[labelServiceNamespace], block.Labels[labelServiceName]))
+		}
+		return nil
+	}
+	cluster, ok := block.Labels[labelCluster]
+	switch {
+	case ok && cluster != owner:
+		return l.reportConflict(service, conflict("ip %s belongs to ip block %s of cluster %s", ip, block.ID, cluster))
+	case !ok && len(block.IPs) == 1:
+		klog.Infof("claiming ip block %s of ip %s for cluster %s", block.ID, ip, owner)
+		return client.LabelIPBlock(ctx, block.ID, labelCluster, owner)
+	}
+	return nil
+}
+
+// checkServerOwner returns a conflict unless server is labeled for the
+// cluster or, without label, is one of the nodes or recorded in the ledger.
+// Manually managed servers carrying an IP are neither. Labels are only
+// checked if clusterID is configured.
+func (l loadbalancer) checkServerOwner(ctx context.Context, client *client2.IONOSClient, server client2.Server, nodes []*v1.Node) error {
+	if owner := l.clientOptions.ClusterID; owner != "" {
+		labels, err := client.ServerLabels(ctx, server.ProviderID)
+		if err != nil {
+			return err
+		}
+		cluster, ok := labels[labelCluster]
+		switch {
+		case ok && cluster != owner:
+			return conflict("server %s belongs to cluster %s", server.Name, cluster)
+		case ok:
+			return nil
+		}
+	}
+	if getNode(server, nodes) != nil {
+		return nil
+	}
+	recorded, err := l.ledger.hasServer(ctx, server.DatacenterID, server.ProviderID)
+	if err != nil {
+		return err
+	}
+	if !recorded {
+		return conflict("server %s is not a node of the cluster", server.Name)
+	}
+	return nil
+}
+
+// claimServer labels the server for the cluster unless it is already labeled
+// or clusterID is not configured.
+func (l loadbalancer) claimServer(ctx context.Context, client *client2.IONOSClient, serverID string) error {
+	owner := l.clientOptions.ClusterID
+	if owner == "" {
+		return nil
+	}
+	labels, err := client.ServerLabels(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	if cluster, ok := labels[labelCluster]; ok {
+		if cluster != owner {
+			return conflict("server %s belongs to cluster %s", serverID, cluster)
+		}
+		return nil
+	}
+	klog.Infof("claiming server %s for cluster %s", serverID, owner)
+	return client.LabelServer(ctx, serverID, labelCluster, owner)
+}
+
+// knownNodes returns all nodes of the cluster from the informer cache once it
+// is synced.
+func (l loadbalancer) knownNodes() []*v1.Node {
+	cached := l.listers.Load()
+	if cached == nil {
+		return nil
+	}
+	nodes, err := cached.nodes.List(labels.Everything())
+	if err != nil {
+		klog.Warningf("failed to list nodes: %v", err)
+		return nil
+	}
+	return nodes
+}
+
+// reportConflict records an ownership conflict as an event of service.
+func (l loadbalancer) reportConflict(service *v1.Service, err error) error {
+	var c *ownershipConflict
+	if errors.As(err, &c) {
+		l.recorder.Eventf(service, v1.EventTypeWarning, "IPOwnershipConflict", "%v", err)
+	}
+	return err
+}
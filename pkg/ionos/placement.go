@@ -0,0 +1,185 @@
+package ionos
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+// GetLoadBalancerNode picks the node the failover IP of service is attached
+// to from the candidates. The pick only depends on the cluster state, so a
+// restart of the controller does not move IPs around.
+func (l loadbalancer) GetLoadBalancerNode(ctx context.Context, service *v1.Service, candidates []*v1.Node) (*v1.Node, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	key := service.Namespace + "/" + service.Name
+	if l.config.Placement == config.PlacementRendezvous {
+		return rendezvous(key, candidates), nil
+	}
+
+	load, err := l.nodeLoad(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	// Nodes with the least load are picked by rendezvous hashing, so Services
+	// placed at the same time do not all end up on the same node.
+	var least []*v1.Node
+	for _, node := range candidates {
+		switch {
+		case len(least) == 0 || load[node.Name] < load[least[0].Name]:
+			least = []*v1.Node{node}
+		case load[node.Name] == load[least[0].Name]:
+			least = append(least, node)
+		}
+	}
+	return rendezvous(key, least), nil
+}
+
+// rendezvous returns the node with the highest hash of key and node name.
+func rendezvous(key string, nodes []*v1.Node) *v1.Node {
+	var (
+		best      *v1.Node
+		bestScore uint64
+	)
+	for _, node := range nodes {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key + "/" + node.Name))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// nodeLoad returns the summed weights of the failover IPs other Services
+// placed on each node, as recorded in their node annotation.
+func (l loadbalancer) nodeLoad(ctx context.Context, service *v1.Service) (map[string]int, error) {
+	services, err := l.listServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	load := map[string]int{}
+	for _, s := range services {
+		node, ok := s.Annotations[annotationLoadBalancerNode]
+		if !ok || s.UID == service.UID || s.Spec.Type != v1.ServiceTypeLoadBalancer || s.DeletionTimestamp != nil ||
+			l.activeMode(s) != config.LoadBalancerModeFailoverIP {
+			continue
+		}
+		load[node] += serviceWeight(s)
+	}
+	return load, nil
+}
+
+// listServices lists all Services from the informer cache once it is synced.
+func (l loadbalancer) listServices(ctx context.Context) ([]*v1.Service, error) {
+	if cached := l.listers.Load(); cached != nil {
+		return cached.services.List(labels.Everything())
+	}
+	if l.kubeClient.Interface == nil {
+		return nil, nil
+	}
+	list, err := l.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	services := make([]*v1.Service, 0, len(list.Items))
+	for i := range list.Items {
+		services = append(services, &list.Items[i])
+	}
+	return services, nil
+}
+
+// serviceWeight returns the weight annotated on service, which defaults to 1.
+func serviceWeight(service *v1.Service) int {
+	value, ok := service.Annotations[annotationLoadBalancerWeight]
+	if !ok {
+		return 1
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < 1 {
+		klog.Warningf("ignoring invalid annotation %s=%q of service %s/%s", annotationLoadBalancerWeight, value,
+			service.Namespace, service.Name)
+		return 1
+	}
+	return weight
+}
+
+// nodesInZone returns the nodes in zone.
+func nodesInZone(nodes []*v1.Node, zone string) []*v1.Node {
+	var result []*v1.Node
+	for _, node := range nodes {
+		if node.Labels[v1.LabelTopologyZone] == zone {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// preferredZoneNodes restricts the candidates to the zone service is
+// annotated with, unless no candidate is in that zone.
+func preferredZoneNodes(service *v1.Service, candidates []*v1.Node) []*v1.Node {
+	zone, ok := service.Annotations[annotationZone]
+	if !ok {
+		return candidates
+	}
+	if inZone := nodesInZone(candidates, zone); len(inZone) > 0 {
+		return inZone
+	}
+	klog.Infof("no eligible node in preferred zone %s of service %s/%s", zone, service.Namespace, service.Name)
+	return candidates
+}
+
+// zoneCandidates restricts the candidates to the zone of previous, the node
+// the failover IP has to move away from, so it fails over within its zone
+// first. Otherwise Services of a spread group are placed in the zones with
+// the fewest IPs of the group.
+func (l loadbalancer) zoneCandidates(ctx context.Context, service *v1.Service, nodes, candidates []*v1.Node, previous *v1.Node) ([]*v1.Node, error) {
+	if previous != nil {
+		if zone, ok := previous.Labels[v1.LabelTopologyZone]; ok {
+			if inZone := nodesInZone(candidates, zone); len(inZone) > 0 {
+				return inZone, nil
+			}
+		}
+	}
+	group, ok := service.Annotations[annotationZoneSpreadGroup]
+	if !ok {
+		return candidates, nil
+	}
+
+	zones := map[string]string{}
+	for _, node := range nodes {
+		zones[node.Name] = node.Labels[v1.LabelTopologyZone]
+	}
+	services, err := l.listServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	count := map[string]int{}
+	for _, s := range services {
+		node, ok := s.Annotations[annotationLoadBalancerNode]
+		if ok && s.UID != service.UID && s.Namespace == service.Namespace && s.Annotations[annotationZoneSpreadGroup] == group &&
+			s.DeletionTimestamp == nil && l.activeMode(s) == config.LoadBalancerModeFailoverIP {
+			count[zones[node]]++
+		}
+	}
+	var least []*v1.Node
+	for _, node := range candidates {
+		zone := node.Labels[v1.LabelTopologyZone]
+		switch {
+		case len(least) == 0 || count[zone] < count[least[0].Labels[v1.LabelTopologyZone]]:
+			least = []*v1.Node{node}
+		case count[zone] == count[least[0].Labels[v1.LabelTopologyZone]]:
+			least = append(least, node)
+		}
+	}
+	return least, nil
+}
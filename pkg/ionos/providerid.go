@@ -0,0 +1,36 @@
+package ionos
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+
+	client2 "github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
+)
+
+// providerIDFromNode parses the provider ID of node. Nodes without provider ID
+// result in an empty ProviderID.
+func providerIDFromNode(node *v1.Node) (client2.ProviderID, error) {
+	if node == nil || node.Spec.ProviderID == "" {
+		return client2.ProviderID{}, nil
+	}
+	return client2.ParseProviderID(node.Spec.ProviderID)
+}
+
+// clientsFor returns the clients which have to be asked for the server behind
+// providerID. Datacenter-qualified provider IDs are routed to their datacenter
+// directly, everything else has to probe every datacenter.
+func clientsFor(ionosClients map[string]*client2.IONOSClient, providerID client2.ProviderID) ([]*client2.IONOSClient, error) {
+	if providerID.DatacenterID != "" {
+		client, ok := ionosClients[providerID.DatacenterID]
+		if !ok {
+			return nil, fmt.Errorf("no client configured for datacenter %s of provider ID %s", providerID.DatacenterID, providerID)
+		}
+		return []*client2.IONOSClient{client}, nil
+	}
+	clients := make([]*client2.IONOSClient, 0, len(ionosClients))
+	for _, client := range ionosClients {
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
@@ -1,7 +1,10 @@
 package ionos
 
 import (
-	"math/rand"
+	"sync/atomic"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/client"
 	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
@@ -10,14 +13,52 @@ import (
 type IONOS struct {
 	config       config.Config
 	instances    instances
+	zones        zones
 	loadbalancer loadbalancer
+	recorder     *recorder
+	kubeClient   *kubeClient
+}
+
+// kubeClient is the Kubernetes client set by Initialize. It is shared by
+// value copies of the provider and nil until then.
+type kubeClient struct {
+	kubernetes.Interface
+	// dynamic accesses the custom resources of the provider.
+	dynamic dynamic.Interface
 }
 
 type instances struct {
-	ionosClients map[string]*client.IONOSClient
+	zoneConfig    config.ZoneConfig
+	clientOptions client.Options
+	parallelism   int
+	lifecycle     lifecycle
+	deletionGuard *deletionGuard
+	recorder      *recorder
+	kubeClient    *kubeClient
+	ionosClients  map[string]*client.IONOSClient
+}
+
+type zones struct {
+	instances instances
 }
 
 type loadbalancer struct {
-	r            *rand.Rand
-	ionosClients map[string]*client.IONOSClient
+	config        config.LoadBalancerConfig
+	nlb           networkLoadBalancer
+	alb           applicationLoadBalancer
+	health        *healthProber
+	servers       *failureStates
+	notReady      *failureStates
+	cordoned      *failureStates
+	noEndpoints   *failureStates
+	stale         *staleHolders
+	hysteresis    *hysteresis
+	ledger        *ipLedger
+	clientOptions client.Options
+	datacenters   map[string]config.DatacenterConfig
+	recorder      *recorder
+	kubeClient    *kubeClient
+	listers       *atomic.Pointer[listers]
+	locks         *serviceLocks
+	ionosClients  map[string]*client.IONOSClient
 }
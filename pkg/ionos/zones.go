@@ -0,0 +1,73 @@
+package ionos
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	"github.com/GDATASoftwareAG/cloud-provider-ionoscloud/pkg/config"
+)
+
+const autoAvailabilityZone = "AUTO"
+
+var _ cloudprovider.Zones = &zones{}
+
+// resolveZone maps the IONOS availability zone of a server in the given
+// datacenter to the zone reported to Kubernetes.
+func resolveZone(cfg config.ZoneConfig, datacenterID, availabilityZone string) string {
+	if cfg.PerDatacenter {
+		if zone, ok := cfg.Datacenters[datacenterID]; ok {
+			return zone
+		}
+		return datacenterID
+	}
+	if zone, ok := cfg.Mapping[availabilityZone]; ok {
+		return zone
+	}
+	if availabilityZone == autoAvailabilityZone {
+		return ""
+	}
+	return availabilityZone
+}
+
+// GetZone returns the Zone containing the current failure zone and locality region that the program is running in.
+// The controller manager runs with host networking, so the hostname is the name of the node it is running on.
+func (z zones) GetZone(ctx context.Context) (cloudprovider.Zone, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return cloudprovider.Zone{}, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	return z.GetZoneByNodeName(ctx, types.NodeName(hostname))
+}
+
+// GetZoneByProviderID returns the Zone containing the current zone and locality region of the node specified by providerID.
+func (z zones) GetZoneByProviderID(ctx context.Context, providerID string) (cloudprovider.Zone, error) {
+	klog.Infof("GetZoneByProviderID %s", providerID)
+	return z.getZone(ctx, &v1.Node{Spec: v1.NodeSpec{ProviderID: providerID}})
+}
+
+// GetZoneByNodeName returns the Zone containing the current zone and locality region of the node specified by node name.
+func (z zones) GetZoneByNodeName(ctx context.Context, nodeName types.NodeName) (cloudprovider.Zone, error) {
+	klog.Infof("GetZoneByNodeName %s", nodeName)
+	return z.getZone(ctx, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: string(nodeName)}})
+}
+
+func (z zones) getZone(ctx context.Context, node *v1.Node) (cloudprovider.Zone, error) {
+	server, err := z.instances.discoverNode(ctx, node)
+	if err != nil {
+		return cloudprovider.Zone{}, err
+	}
+	if server == nil {
+		return cloudprovider.Zone{}, cloudprovider.InstanceNotFound
+	}
+	return cloudprovider.Zone{
+		FailureDomain: server.Metadata.Zone,
+		Region:        server.Metadata.Region,
+	}, nil
+}